@@ -14,6 +14,8 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 )
 
+const jobDrainTimeout = 10 * time.Second
+
 func gracefulShutdown(fiberServer *server.FiberServer, done chan bool) {
 	// Create context that listens for the interrupt signal from the OS.
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -32,6 +34,17 @@ func gracefulShutdown(fiberServer *server.FiberServer, done chan bool) {
 	if err := fiberServer.ShutdownWithContext(ctx); err != nil {
 		log.Printf("Server forced to shutdown with error: %v", err)
 	}
+	if err := fiberServer.StopBackgroundJobs(ctx); err != nil {
+		log.Printf("Background jobs did not stop in time: %v", err)
+	}
+
+	// Queued jobs get their own deadline to finish what they are doing;
+	// whatever is still running after it is retried by the next process.
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), jobDrainTimeout)
+	defer cancelDrain()
+	if err := fiberServer.DrainJobQueue(drainCtx); err != nil {
+		log.Printf("Job queue did not drain in time: %v", err)
+	}
 
 	log.Println("Server exiting")
 
@@ -44,6 +57,7 @@ func main() {
 	server := server.New(os.Getenv("DB_ADDR"))
 
 	server.RegisterFiberRoutes()
+	server.StartBackgroundJobs()
 
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
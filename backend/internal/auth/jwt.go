@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"errors"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -10,6 +12,12 @@ import (
 
 var jwtSecret []byte
 
+// preAuthAudience marks tokens issued between the password and the second
+// factor of a login. They only unlock the two-factor step, never the API.
+const preAuthAudience = "nimbledb-demo-2fa"
+
+var ErrPreAuthToken = errors.New("pre-auth token cannot be used as a session")
+
 func init() {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
@@ -24,16 +32,23 @@ type Claims struct {
 	Name   string `json:"name"`
 	Image  string `json:"image"`
 	Role   string `json:"role"`
+	// SessionVersion is the user's session version when the token was
+	// issued. Changing the password bumps it, ending older sessions.
+	SessionVersion int64 `json:"session_version"`
 	jwt.RegisteredClaims
+
+	AccessTokenID int64    `json:"-"`
+	Scopes        []string `json:"-"`
 }
 
-func GenerateToken(userId int64, email string, name string, image string, role string) (string, error) {
+func GenerateToken(userId int64, email string, name string, image string, role string, sessionVersion int64) (string, error) {
 	claims := &Claims{
-		Email:  email,
-		UserID: userId,
-		Name:   name,
-		Image:  image,
-		Role:   role,
+		Email:          email,
+		UserID:         userId,
+		Name:           name,
+		Image:          image,
+		Role:           role,
+		SessionVersion: sessionVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -60,5 +75,54 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		return nil, jwt.ErrSignatureInvalid
 	}
 
+	if claims.VerifyAudience(preAuthAudience, true) {
+		return nil, ErrPreAuthToken
+	}
+
 	return claims, nil
 }
+
+// preAuthClaims carry the user's last accepted TOTP step when the token was
+// issued. Passing the second factor advances the step, so each pre-auth
+// token can complete one login at most.
+type preAuthClaims struct {
+	TOTPStep int64 `json:"totp_step"`
+	jwt.RegisteredClaims
+}
+
+func GeneratePreAuthToken(userId int64, totpStep int64) (string, error) {
+	claims := &preAuthClaims{
+		TOTPStep: totpStep,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(userId, 10),
+			Audience:  jwt.ClaimStrings{preAuthAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(5 * time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "nimbledb-demo",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(jwtSecret)
+}
+
+// ValidatePreAuthToken returns the user a pre-auth token was issued to and
+// the TOTP step it was issued at.
+func ValidatePreAuthToken(tokenString string) (int64, int64, error) {
+	claims := &preAuthClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (any, error) {
+		return jwtSecret, nil
+	})
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !token.Valid || !claims.VerifyAudience(preAuthAudience, true) {
+		return 0, 0, jwt.ErrSignatureInvalid
+	}
+
+	userID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	return userID, claims.TOTPStep, err
+}
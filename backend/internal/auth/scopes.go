@@ -0,0 +1,46 @@
+package auth
+
+const (
+	ScopePostsRead    = "posts:read"
+	ScopePostsWrite   = "posts:write"
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+)
+
+var validScopes = map[string]bool{
+	ScopePostsRead:    true,
+	ScopePostsWrite:   true,
+	ScopeProfileRead:  true,
+	ScopeProfileWrite: true,
+}
+
+func IsValidScope(scope string) bool {
+	return validScopes[scope]
+}
+
+const RoleAdmin = "admin"
+
+func (c *Claims) IsAdmin() bool {
+	return c.Role == RoleAdmin
+}
+
+// IsAccessToken reports whether the request was authenticated with a personal
+// access token rather than a login session.
+func (c *Claims) IsAccessToken() bool {
+	return c.AccessTokenID != 0
+}
+
+// HasScope reports whether the caller may act within scope. Login sessions
+// are unrestricted; personal access tokens only carry the scopes they were
+// created with.
+func (c *Claims) HasScope(scope string) bool {
+	if !c.IsAccessToken() {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
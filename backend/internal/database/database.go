@@ -14,6 +14,9 @@ type Service interface {
 	Close() error
 	Query(query string) ([]string, [][]interface{}, error)
 	Execute(query string) error
+	// ExecuteAffected runs an UPDATE or DELETE and returns how many rows it
+	// touched.
+	ExecuteAffected(query string) (int64, error)
 	QueryRow(query string) ([]interface{}, error)
 }
 
@@ -88,6 +91,21 @@ func (s *service) Execute(query string) error {
 	return err
 }
 
+func (s *service) ExecuteAffected(query string) (int64, error) {
+	_, rows, err := s.client.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return 0, fmt.Errorf("no rows_affected in result")
+	}
+	affected, ok := rows[0][0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected rows_affected value %v", rows[0][0])
+	}
+	return affected, nil
+}
+
 func (s *service) QueryRow(query string) ([]interface{}, error) {
 	_, rows, err := s.client.Query(query)
 	if err != nil {
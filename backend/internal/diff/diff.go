@@ -0,0 +1,74 @@
+// Package diff computes line-level differences between two texts.
+package diff
+
+import "strings"
+
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// Line is one line of a diff. Delete lines come from the old text, Insert
+// lines from the new one and Equal lines from both.
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines diffs a against b line by line using their longest common
+// subsequence. Within a changed block deletions come before insertions.
+func Lines(a, b string) []Line {
+	before := splitLines(a)
+	after := splitLines(b)
+
+	// lcs[i][j] is the LCS length of before[i:] and after[j:].
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]Line, 0, len(before)+len(after))
+	i, j := 0, 0
+	for i < len(before) && j < len(after) {
+		switch {
+		case before[i] == after[j]:
+			lines = append(lines, Line{Op: Equal, Text: before[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Op: Delete, Text: before[i]})
+			i++
+		default:
+			lines = append(lines, Line{Op: Insert, Text: after[j]})
+			j++
+		}
+	}
+	for ; i < len(before); i++ {
+		lines = append(lines, Line{Op: Delete, Text: before[i]})
+	}
+	for ; j < len(after); j++ {
+		lines = append(lines, Line{Op: Insert, Text: after[j]})
+	}
+
+	return lines
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
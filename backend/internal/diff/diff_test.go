@@ -0,0 +1,60 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{
+			name: "identical",
+			a:    "one\ntwo",
+			b:    "one\ntwo",
+			want: []Line{{Equal, "one"}, {Equal, "two"}},
+		},
+		{
+			name: "both empty",
+			a:    "",
+			b:    "",
+			want: []Line{},
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "one\ntwo\n",
+			want: []Line{{Insert, "one"}, {Insert, "two"}},
+		},
+		{
+			name: "changed line",
+			a:    "one\ntwo\nthree",
+			b:    "one\n2\nthree",
+			want: []Line{{Equal, "one"}, {Delete, "two"}, {Insert, "2"}, {Equal, "three"}},
+		},
+		{
+			name: "insert and delete",
+			a:    "a\nb\nc\nd",
+			b:    "a\nc\nd\ne",
+			want: []Line{{Equal, "a"}, {Delete, "b"}, {Equal, "c"}, {Equal, "d"}, {Insert, "e"}},
+		},
+		{
+			name: "crlf line endings",
+			a:    "one\r\ntwo",
+			b:    "one\ntwo",
+			want: []Line{{Equal, "one"}, {Equal, "two"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Lines(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
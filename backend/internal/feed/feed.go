@@ -0,0 +1,190 @@
+// Package feed writes syndication documents in RSS 2.0 and Atom 1.0 for
+// feed readers. Text and HTML content are escaped by the XML encoder, so
+// entries can carry rendered post HTML as is.
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Feed is a format-neutral description of a feed.
+type Feed struct {
+	Title       string
+	Description string
+	// Link is the page the feed is about and Self is where the feed
+	// itself is served. Both must be absolute URLs.
+	Link    string
+	Self    string
+	Updated time.Time
+	Entries []Entry
+}
+
+type Entry struct {
+	// ID identifies the entry for good, even if its title or link change.
+	ID         string
+	Title      string
+	Link       string
+	Author     string
+	Published  time.Time
+	Updated    time.Time
+	HTML       string
+	Categories []string
+}
+
+const (
+	atomNS = "http://www.w3.org/2005/Atom"
+	dcNS   = "http://purl.org/dc/elements/1.1/"
+)
+
+type rssDoc struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          rssLink   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS encodes f as an RSS 2.0 document.
+func RSS(f *Feed) ([]byte, error) {
+	doc := rssDoc{
+		Version: "2.0",
+		AtomNS:  atomNS,
+		DCNS:    dcNS,
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Description,
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+			Self:          rssLink{Href: f.Self, Rel: "self", Type: "application/rss+xml"},
+			Items:         make([]rssItem, 0, len(f.Entries)),
+		},
+	}
+
+	for _, e := range f.Entries {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.Link,
+			GUID:        rssGUID{IsPermaLink: e.ID == e.Link, Value: e.ID},
+			PubDate:     e.Published.UTC().Format(time.RFC1123Z),
+			Creator:     e.Author,
+			Categories:  e.Categories,
+			Description: e.HTML,
+		})
+	}
+
+	return encode(doc)
+}
+
+type atomDoc struct {
+	XMLName  xml.Name    `xml:"feed"`
+	NS       string      `xml:"xmlns,attr"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomAuthor     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Atom encodes f as an Atom 1.0 document. The feed's id is its Self URL.
+func Atom(f *Feed) ([]byte, error) {
+	doc := atomDoc{
+		NS:       atomNS,
+		ID:       f.Self,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Updated:  f.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.Self, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+		},
+		Entries: make([]atomEntry, 0, len(f.Entries)),
+	}
+
+	for _, e := range f.Entries {
+		entry := atomEntry{
+			ID:        e.ID,
+			Title:     e.Title,
+			Link:      atomLink{Href: e.Link, Rel: "alternate", Type: "text/html"},
+			Published: e.Published.UTC().Format(time.RFC3339),
+			Updated:   e.Updated.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: e.Author},
+			Content:   atomContent{Type: "html", Value: e.HTML},
+		}
+		for _, term := range e.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: term})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return encode(doc)
+}
+
+func encode(doc any) ([]byte, error) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
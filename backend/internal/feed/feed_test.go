@@ -0,0 +1,115 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFeed() *Feed {
+	published := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &Feed{
+		Title:   "Posts & <news>",
+		Link:    "https://example.com",
+		Self:    "https://api.example.com/feed.atom",
+		Updated: published.Add(time.Hour),
+		Entries: []Entry{{
+			ID:         "https://example.com/posts/1",
+			Title:      `Tom & "Jerry"`,
+			Link:       "https://example.com/posts/1",
+			Author:     "Ann",
+			Published:  published,
+			Updated:    published.Add(time.Hour),
+			HTML:       "<p>a &amp; b</p>",
+			Categories: []string{"go"},
+		}},
+	}
+}
+
+func TestRSS(t *testing.T) {
+	body, err := RSS(testFeed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Channel struct {
+			Title         string `xml:"title"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title       string `xml:"title"`
+				GUID        string `xml:"guid"`
+				PubDate     string `xml:"pubDate"`
+				Description string `xml:"description"`
+				Category    string `xml:"category"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("RSS() is not well-formed XML: %v\n%s", err, body)
+	}
+
+	if doc.Channel.Title != "Posts & <news>" {
+		t.Errorf("title = %q", doc.Channel.Title)
+	}
+	if doc.Channel.LastBuildDate != "Sun, 01 Mar 2026 13:00:00 +0000" {
+		t.Errorf("lastBuildDate = %q", doc.Channel.LastBuildDate)
+	}
+	if len(doc.Channel.Items) != 1 {
+		t.Fatalf("got %d items, want 1", len(doc.Channel.Items))
+	}
+	item := doc.Channel.Items[0]
+	if item.Title != `Tom & "Jerry"` || item.Description != "<p>a &amp; b</p>" || item.Category != "go" {
+		t.Errorf("item = %+v", item)
+	}
+	if item.PubDate != "Sun, 01 Mar 2026 12:00:00 +0000" {
+		t.Errorf("pubDate = %q", item.PubDate)
+	}
+	if !strings.Contains(string(body), `<guid isPermaLink="true">`) {
+		t.Errorf("guid is not marked as a permalink:\n%s", body)
+	}
+}
+
+func TestAtom(t *testing.T) {
+	body, err := Atom(testFeed())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Updated string   `xml:"updated"`
+		Entries []struct {
+			ID      string `xml:"id"`
+			Title   string `xml:"title"`
+			Updated string `xml:"updated"`
+			Author  string `xml:"author>name"`
+			Content struct {
+				Type  string `xml:"type,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("Atom() is not a well-formed Atom feed: %v\n%s", err, body)
+	}
+
+	if doc.ID != "https://api.example.com/feed.atom" || doc.Updated != "2026-03-01T13:00:00Z" {
+		t.Errorf("feed id = %q, updated = %q", doc.ID, doc.Updated)
+	}
+	if len(doc.Entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(doc.Entries))
+	}
+	entry := doc.Entries[0]
+	if entry.Title != `Tom & "Jerry"` || entry.Author != "Ann" || entry.Updated != "2026-03-01T13:00:00Z" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry.Content.Type != "html" || entry.Content.Value != "<p>a &amp; b</p>" {
+		t.Errorf("content = %+v", entry.Content)
+	}
+	if strings.Contains(string(body), "<p>") {
+		t.Errorf("HTML content was not escaped:\n%s", body)
+	}
+}
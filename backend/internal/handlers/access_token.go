@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/repository"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultAccessTokenDays = 30
+	maxAccessTokenDays     = 365
+)
+
+type AccessTokenHandler struct {
+	tokenRepo *repository.AccessTokenRepository
+}
+
+func NewAccessTokenHandler(tokenRepo *repository.AccessTokenRepository) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		tokenRepo: tokenRepo,
+	}
+}
+
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name" validate:"required"`
+	Scopes        []string `json:"scopes" validate:"required"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+func (h *AccessTokenHandler) CreateToken(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req CreateAccessTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Name is required and must be at most 100 characters",
+		})
+	}
+
+	if len(req.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one scope is required",
+		})
+	}
+	for _, scope := range req.Scopes {
+		if !auth.IsValidScope(scope) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown scope: " + scope,
+			})
+		}
+	}
+
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAccessTokenDays
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > maxAccessTokenDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expires_in_days must be between 1 and " + strconv.Itoa(maxAccessTokenDays),
+		})
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+	secret := middleware.AccessTokenPrefix + hex.EncodeToString(raw)
+
+	token, err := h.tokenRepo.CreateToken(models.CreateAccessTokenParams{
+		UserID:    userClaims.UserID,
+		Name:      req.Name,
+		TokenHash: middleware.HashAccessToken(secret),
+		Scopes:    req.Scopes,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create token: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"token":  token,
+		"secret": secret,
+	})
+}
+
+func (h *AccessTokenHandler) GetTokens(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	tokens, err := h.tokenRepo.GetTokensByUserID(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch tokens: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"tokens": tokens,
+	})
+}
+
+func (h *AccessTokenHandler) DeleteToken(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	idStr := c.Params("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid token ID",
+		})
+	}
+
+	isOwner, err := h.tokenRepo.CheckTokenOwnership(id, userClaims.UserID)
+	if err != nil || !isOwner {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Token not found",
+		})
+	}
+
+	if err := h.tokenRepo.DeleteToken(id); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke token: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Token revoked successfully",
+	})
+}
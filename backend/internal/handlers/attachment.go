@@ -0,0 +1,648 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/jobs"
+	"backend/internal/media"
+	"backend/internal/models"
+	"backend/internal/repository"
+	"backend/internal/storage"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxAttachmentsPerPost = 20
+	maxAvatarBytes        = 2 << 20
+	thumbnailSize         = 400
+	avatarSize            = 256
+)
+
+// ThumbnailJob is the kind of job that makes an image attachment's
+// thumbnail.
+const ThumbnailJob = "attachment.thumbnail"
+
+type thumbnailJob struct {
+	AttachmentID int64 `json:"attachment_id"`
+}
+
+type AttachmentHandler struct {
+	attachmentRepo *repository.AttachmentRepository
+	postRepo       *repository.PostRepository
+	userRepo       *repository.UserRepository
+	store          storage.BlobStore
+	queue          *jobs.Queue
+
+	maxUploadBytes int64
+	// publicURL is prefixed to file URLs so they work from other origins,
+	// e.g. as an avatar image on the frontend.
+	publicURL string
+}
+
+func NewAttachmentHandler(
+	attachmentRepo *repository.AttachmentRepository,
+	postRepo *repository.PostRepository,
+	userRepo *repository.UserRepository,
+	store storage.BlobStore,
+	queue *jobs.Queue,
+	maxUploadBytes int64,
+	publicURL string,
+) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachmentRepo: attachmentRepo,
+		postRepo:       postRepo,
+		userRepo:       userRepo,
+		store:          store,
+		queue:          queue,
+		maxUploadBytes: maxUploadBytes,
+		publicURL:      strings.TrimRight(publicURL, "/"),
+	}
+}
+
+func (h *AttachmentHandler) presentAttachment(attachment *models.Attachment) AttachmentView {
+	return presentAttachment(attachment, h.fileURL(attachment.ID))
+}
+
+func (h *AttachmentHandler) fileURL(id int64) string {
+	return h.publicURL + "/api/attachments/" + strconv.FormatInt(id, 10)
+}
+
+func (h *AttachmentHandler) GetAttachments(c *fiber.Ctx) error {
+	postID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+	}
+
+	post, err := h.postRepo.GetPostByID(postID)
+	if err != nil || !canViewPost(post, viewerClaims(c)) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+
+	attachments, err := h.attachmentRepo.GetAttachmentsByPostID(postID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch attachments: " + err.Error(),
+		})
+	}
+
+	views := make([]AttachmentView, 0, len(attachments))
+	for i := range attachments {
+		views = append(views, h.presentAttachment(&attachments[i]))
+	}
+
+	return c.JSON(fiber.Map{
+		"attachments": views,
+	})
+}
+
+// UploadAttachment stores a file sent as the "file" field of a multipart
+// form and attaches it to a post. The type is decided by sniffing the
+// content. Images get a JPEG thumbnail, made in the background: until it is
+// ready the attachment has no thumbnail_url.
+func (h *AttachmentHandler) UploadAttachment(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	postID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+	}
+
+	isOwner, err := h.postRepo.CheckPostOwnership(postID, userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+	if !isOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to add files to this post",
+		})
+	}
+
+	existing, err := h.attachmentRepo.GetAttachmentsByPostID(postID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch attachments: " + err.Error(),
+		})
+	}
+	if len(existing) >= maxAttachmentsPerPost {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("A post can have at most %d attachments", maxAttachmentsPerPost),
+		})
+	}
+
+	data, filename, ok := readUpload(c, h.maxUploadBytes)
+	if !ok {
+		return nil
+	}
+
+	contentType := media.Sniff(data)
+	if !media.IsAllowed(contentType) {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "Unsupported file type " + contentType,
+		})
+	}
+
+	name, err := blobName()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store file",
+		})
+	}
+	params := models.CreateAttachmentParams{
+		PostID:      postID,
+		UserID:      userClaims.UserID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		StorageKey:  fmt.Sprintf("attachments/%d/%s", postID, name),
+	}
+
+	isImage := media.IsImage(contentType)
+	if isImage {
+		params.Width, params.Height, err = media.Dimensions(data)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid image: " + err.Error(),
+			})
+		}
+	}
+
+	if !h.putBlob(c, params, data) {
+		return nil
+	}
+
+	attachment, err := h.attachmentRepo.CreateAttachment(params)
+	if err != nil {
+		h.deleteBlobs(c, params.StorageKey)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save attachment: " + err.Error(),
+		})
+	}
+
+	if isImage {
+		if err := h.queue.Enqueue(ThumbnailJob, thumbnailJob{AttachmentID: attachment.ID}); err != nil {
+			log.Printf("Failed to queue thumbnail of attachment %d: %v", attachment.ID, err)
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"attachment": h.presentAttachment(attachment),
+	})
+}
+
+// MakeThumbnail is the handler of ThumbnailJob. Attachments deleted before
+// it runs are skipped.
+func (h *AttachmentHandler) MakeThumbnail(ctx context.Context, payload []byte) error {
+	var job thumbnailJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	attachment, err := h.attachmentRepo.GetAttachmentByID(job.AttachmentID)
+	if errors.Is(err, repository.ErrAttachmentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if attachment.ThumbnailKey != "" {
+		return nil
+	}
+
+	blob, err := h.store.Get(ctx, attachment.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		return err
+	}
+
+	thumb, _, _, err := media.Thumbnail(data, thumbnailSize)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+
+	key := attachment.StorageKey + "-thumb.jpg"
+	if err := h.store.Put(ctx, key, "image/jpeg", thumb); err != nil {
+		return err
+	}
+
+	saved, err := h.attachmentRepo.SetThumbnailKey(attachment.ID, key)
+	if err != nil {
+		return err
+	}
+	if !saved {
+		// Deleted while the thumbnail was being made; nothing points at it.
+		if err := h.store.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete blob %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func (h *AttachmentHandler) DeleteAttachment(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	postID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+	}
+	attachmentID, err := strconv.ParseInt(c.Params("attachmentId"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid attachment ID",
+		})
+	}
+
+	isOwner, err := h.postRepo.CheckPostOwnership(postID, userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+	if !isOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to remove files from this post",
+		})
+	}
+
+	attachment, err := h.attachmentRepo.GetAttachmentByID(attachmentID)
+	if err != nil || attachment.PostID != postID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+	}
+
+	if err := h.attachmentRepo.DeleteAttachment(attachment.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete attachment: " + err.Error(),
+		})
+	}
+	h.deleteBlobs(c, attachment.StorageKey, attachment.ThumbnailKey)
+
+	return c.JSON(fiber.Map{
+		"message": "Attachment deleted successfully",
+	})
+}
+
+// ServeAttachment streams a file to anyone who can see the post it belongs
+// to. Files not tied to a post, such as avatars, are public.
+func (h *AttachmentHandler) ServeAttachment(c *fiber.Ctx) error {
+	attachment, public, ok := h.visibleAttachment(c)
+	if !ok {
+		return nil
+	}
+
+	disposition := "attachment"
+	if media.IsImage(attachment.ContentType) {
+		disposition = "inline"
+	}
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+
+	return h.sendBlob(c, attachment.StorageKey, attachment.ContentType, public)
+}
+
+func (h *AttachmentHandler) ServeThumbnail(c *fiber.Ctx) error {
+	attachment, public, ok := h.visibleAttachment(c)
+	if !ok {
+		return nil
+	}
+	if attachment.ThumbnailKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment has no thumbnail",
+		})
+	}
+
+	return h.sendBlob(c, attachment.ThumbnailKey, "image/jpeg", public)
+}
+
+// UploadAvatar replaces the caller's profile image with an uploaded one,
+// scaled down to avatarSize.
+func (h *AttachmentHandler) UploadAvatar(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	data, _, ok := readUpload(c, maxAvatarBytes)
+	if !ok {
+		return nil
+	}
+
+	if contentType := media.Sniff(data); !media.IsImage(contentType) {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "Avatar must be a JPEG, PNG, GIF or WebP image",
+		})
+	}
+
+	avatar, _, _, err := media.Thumbnail(data, avatarSize)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid image: " + err.Error(),
+		})
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(avatar))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process image",
+		})
+	}
+
+	name, err := blobName()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store file",
+		})
+	}
+	params := models.CreateAttachmentParams{
+		UserID:      userClaims.UserID,
+		Filename:    "avatar.jpg",
+		ContentType: "image/jpeg",
+		Size:        int64(len(avatar)),
+		Width:       config.Width,
+		Height:      config.Height,
+		StorageKey:  fmt.Sprintf("avatars/%d/%s.jpg", userClaims.UserID, name),
+	}
+
+	if !h.putBlob(c, params, avatar) {
+		return nil
+	}
+
+	attachment, err := h.attachmentRepo.CreateAttachment(params)
+	if err != nil {
+		h.deleteBlobs(c, params.StorageKey)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save avatar: " + err.Error(),
+		})
+	}
+
+	return h.setAvatar(c, userClaims, h.fileURL(attachment.ID), attachment.ID)
+}
+
+// DeleteAvatar goes back to the generated profile image.
+func (h *AttachmentHandler) DeleteAvatar(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	user, err := h.userRepo.GetUserById(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get user",
+		})
+	}
+
+	return h.setAvatar(c, userClaims, defaultAvatarURL(user.Email), 0)
+}
+
+// setAvatar points the user's image at imageURL and removes their other
+// uploaded avatars, keeping the one with ID keep.
+func (h *AttachmentHandler) setAvatar(c *fiber.Ctx, userClaims *auth.Claims, imageURL string, keep int64) error {
+	user, err := h.userRepo.GetUserById(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get user",
+		})
+	}
+
+	err = h.userRepo.UpdateUser(user.ID, models.UpdateUserParams{
+		Email: user.Email,
+		Name:  user.Name,
+		Image: imageURL,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update profile: " + err.Error(),
+		})
+	}
+	user.Image = imageURL
+
+	files, err := h.attachmentRepo.GetUserFiles(user.ID)
+	if err != nil {
+		log.Printf("Failed to list old avatars of user %d: %v", user.ID, err)
+	}
+	for _, file := range files {
+		if file.ID == keep {
+			continue
+		}
+		if err := h.attachmentRepo.DeleteAttachment(file.ID); err != nil {
+			log.Printf("Failed to delete old avatar %d: %v", file.ID, err)
+			continue
+		}
+		h.deleteBlobs(c, file.StorageKey)
+	}
+
+	// The session JWT carries the profile image, see UpdateMe.
+	if !userClaims.IsAccessToken() {
+		if err := setSessionCookie(c, user); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate token",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"user": presentUser(user, nil, userClaims),
+	})
+}
+
+// visibleAttachment loads the attachment named by the :id param and checks
+// the caller may see it. public reports whether anyone may, which decides
+// how long shared caches may keep the file.
+func (h *AttachmentHandler) visibleAttachment(c *fiber.Ctx) (attachment *models.Attachment, public bool, ok bool) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid attachment ID",
+		})
+		return nil, false, false
+	}
+
+	attachment, err = h.attachmentRepo.GetAttachmentByID(id)
+	if err != nil {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+		return nil, false, false
+	}
+	if attachment.PostID == 0 {
+		return attachment, true, true
+	}
+
+	post, err := h.postRepo.GetPostByID(attachment.PostID)
+	if err != nil || !canViewPost(post, viewerClaims(c)) {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+		return nil, false, false
+	}
+	return attachment, post.Status == models.PostStatusPublished, true
+}
+
+func (h *AttachmentHandler) sendBlob(c *fiber.Ctx, key, contentType string, public bool) error {
+	blob, err := h.store.Get(c.UserContext(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Attachment not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read file: " + err.Error(),
+		})
+	}
+
+	// Blobs never change under a key, but a post can stop being public.
+	if public {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+	} else {
+		c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	}
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.SendStream(blob)
+}
+
+func (h *AttachmentHandler) putBlob(c *fiber.Ctx, params models.CreateAttachmentParams, data []byte) bool {
+	if err := h.store.Put(c.UserContext(), params.StorageKey, params.ContentType, data); err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store file: " + err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// deleteBlobs removes blobs whose rows are gone. Failures only leak storage,
+// so they are logged rather than failing the request.
+func (h *AttachmentHandler) deleteBlobs(c *fiber.Ctx, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := h.store.Delete(c.UserContext(), key); err != nil {
+			log.Printf("Failed to delete blob %s: %v", key, err)
+		}
+	}
+}
+
+// readUpload reads the "file" field of a multipart form, refusing files
+// over limit bytes.
+func readUpload(c *fiber.Ctx, limit int64) ([]byte, string, bool) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Expected a multipart form with a file field",
+		})
+		return nil, "", false
+	}
+	if header.Size > limit {
+		c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": fmt.Sprintf("File must be at most %d bytes", limit),
+		})
+		return nil, "", false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to read upload",
+		})
+		return nil, "", false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to read upload",
+		})
+		return nil, "", false
+	}
+	if int64(len(data)) > limit {
+		c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": fmt.Sprintf("File must be at most %d bytes", limit),
+		})
+		return nil, "", false
+	}
+	if len(data) == 0 {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "File is empty",
+		})
+		return nil, "", false
+	}
+
+	return data, cleanFilename(header.Filename), true
+}
+
+// cleanFilename keeps the base name of an uploaded file, without control
+// characters and short enough for the filename column.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
+
+// blobName returns a random name, so keys can't be guessed or collide.
+func blobName() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
@@ -4,8 +4,12 @@ import (
 	"backend/internal/auth"
 	"backend/internal/models"
 	"backend/internal/repository"
+	"backend/internal/webhook"
+	"log"
+	"math"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,13 +17,26 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	maxFailedLogins = 5
+	baseLockout     = time.Minute
+	maxLockout      = time.Hour
+	loginEventLimit = 20
+)
+
 type AuthHandler struct {
-	userRepo *repository.UserRepository
+	userRepo         *repository.UserRepository
+	loginEventRepo   *repository.LoginEventRepository
+	recoveryCodeRepo *repository.RecoveryCodeRepository
+	webhooks         *webhook.Dispatcher
 }
 
-func NewAuthHandler(userRepo *repository.UserRepository) *AuthHandler {
+func NewAuthHandler(userRepo *repository.UserRepository, loginEventRepo *repository.LoginEventRepository, recoveryCodeRepo *repository.RecoveryCodeRepository, webhooks *webhook.Dispatcher) *AuthHandler {
 	return &AuthHandler{
-		userRepo: userRepo,
+		userRepo:         userRepo,
+		loginEventRepo:   loginEventRepo,
+		recoveryCodeRepo: recoveryCodeRepo,
+		webhooks:         webhooks,
 	}
 }
 
@@ -40,6 +57,16 @@ type AuthResponse struct {
 	Name  string `json:"name"`
 }
 
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8"`
+}
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	PreAuthToken      string `json:"pre_auth_token"`
+}
+
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var req RegisterRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -59,9 +86,7 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		Email:    req.Email,
 		Password: string(hashedPassword),
 		Name:     req.Name,
-		Image: "https://api.dicebear.com/7.x/bottts-neutral/svg?seed=" +
-			url.QueryEscape(req.Email) +
-			"&backgroundColor=3b82f6,8b5cf6,ec4899,f59e0b,10b981",
+		Image:    defaultAvatarURL(req.Email),
 	})
 	if err != nil {
 		errMsg := err.Error()
@@ -76,23 +101,14 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
-	token, err := auth.GenerateToken(user.ID, user.Email, user.Name, user.Image, user.Role)
-	if err != nil {
+	queueWebhookEvent(h.webhooks, models.WebhookUserCreated, presentWebhookUser(user))
+
+	if err := setSessionCookie(c, user); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
 		})
 	}
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "nimbledb-test_token",
-		Value:    token,
-		Path:     "/",
-		HTTPOnly: true,
-		Secure:   os.Getenv("IS_PROD") == "true",
-		SameSite: "None",
-		Expires:  time.Now().Add(24 * time.Hour),
-	})
-
 	return c.JSON(AuthResponse{
 		ID:    user.ID,
 		Email: user.Email,
@@ -115,30 +131,49 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	if time.Now().Before(user.LockedUntil) {
+		return h.rejectLocked(c, user)
+	}
+
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
 	if err != nil {
+		h.recordLoginFailure(c, user, models.LoginOutcomeInvalidPassword)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid credentials",
 		})
 	}
 
-	token, err := auth.GenerateToken(user.ID, user.Email, user.Name, user.Image, user.Role)
-	if err != nil {
+	if user.TOTPEnabled {
+		preAuthToken, err := auth.GeneratePreAuthToken(user.ID, user.TOTPLastStep)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate token",
+			})
+		}
+
+		return c.JSON(TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			PreAuthToken:      preAuthToken,
+		})
+	}
+
+	return h.completeLogin(c, user)
+}
+
+func (h *AuthHandler) completeLogin(c *fiber.Ctx, user *models.User) error {
+	if user.FailedLogins > 0 {
+		if err := h.userRepo.ResetLoginFailures(user.ID); err != nil {
+			log.Printf("Failed to reset login failures for user %d: %v", user.ID, err)
+		}
+	}
+	h.recordLoginEvent(c, user.ID, models.LoginOutcomeSuccess)
+
+	if err := setSessionCookie(c, user); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
 		})
 	}
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "nimbledb-test_token",
-		Value:    token,
-		Path:     "/",
-		HTTPOnly: true,
-		Secure:   os.Getenv("IS_PROD") == "true",
-		SameSite: "None",
-		Expires:  time.Now().Add(24 * time.Hour),
-	})
-
 	return c.JSON(AuthResponse{
 		ID:    user.ID,
 		Email: user.Email,
@@ -162,12 +197,163 @@ func (h *AuthHandler) GetMe(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"user": fiber.Map{
-			"id":    user.ID,
-			"email": user.Email,
-			"name":  user.Name,
-			"image": user.Image,
-			"role":  user.Role,
-		},
+		"user": presentUser(user, nil, userClaims),
+	})
+}
+
+func (h *AuthHandler) ChangePassword(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid user claims",
+		})
+	}
+
+	var req ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	if len(req.NewPassword) < 8 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "New password must be at least 8 characters",
+		})
+	}
+
+	user, err := h.userRepo.GetUserById(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get user",
+		})
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Current password is incorrect",
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to hash password",
+		})
+	}
+
+	// Bumping the session version signs out every other session; this one
+	// gets a new cookie below.
+	user.SessionVersion++
+	if err := h.userRepo.UpdatePassword(user.ID, string(hashedPassword), user.SessionVersion); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update password: " + err.Error(),
+		})
+	}
+
+	if err := setSessionCookie(c, user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password changed successfully",
 	})
 }
+
+func (h *AuthHandler) GetLoginEvents(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid user claims",
+		})
+	}
+
+	events, err := h.loginEventRepo.GetRecentByUserID(userClaims.UserID, loginEventLimit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch login events: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"events": events,
+	})
+}
+
+func (h *AuthHandler) rejectLocked(c *fiber.Ctx, user *models.User) error {
+	h.recordLoginEvent(c, user.ID, models.LoginOutcomeLocked)
+
+	retryAfter := int(math.Ceil(time.Until(user.LockedUntil).Seconds()))
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+	return c.Status(fiber.StatusLocked).JSON(fiber.Map{
+		"error": "Account temporarily locked due to too many failed login attempts",
+	})
+}
+
+func (h *AuthHandler) recordLoginFailure(c *fiber.Ctx, user *models.User, outcome string) {
+	failures := user.FailedLogins + 1
+
+	var lockedUntil time.Time
+	if failures >= maxFailedLogins {
+		lockedUntil = time.Now().Add(lockoutDuration(failures))
+	}
+
+	if err := h.userRepo.SetLoginFailures(user.ID, failures, lockedUntil); err != nil {
+		log.Printf("Failed to record login failure for user %d: %v", user.ID, err)
+	}
+	h.recordLoginEvent(c, user.ID, outcome)
+}
+
+func (h *AuthHandler) recordLoginEvent(c *fiber.Ctx, userID int64, outcome string) {
+	_, err := h.loginEventRepo.CreateLoginEvent(models.CreateLoginEventParams{
+		UserID:    userID,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Outcome:   outcome,
+	})
+	if err != nil {
+		log.Printf("Failed to record login event for user %d: %v", userID, err)
+	}
+}
+
+// lockoutDuration doubles the lockout for every failure past maxFailedLogins.
+func lockoutDuration(failures int) time.Duration {
+	exponent := failures - maxFailedLogins
+	if exponent > 6 {
+		return maxLockout
+	}
+
+	lockout := baseLockout << exponent
+	if lockout > maxLockout {
+		return maxLockout
+	}
+	return lockout
+}
+
+// defaultAvatarURL is the generated image users have until they upload one.
+func defaultAvatarURL(email string) string {
+	return "https://api.dicebear.com/7.x/bottts-neutral/svg?seed=" +
+		url.QueryEscape(email) +
+		"&backgroundColor=3b82f6,8b5cf6,ec4899,f59e0b,10b981"
+}
+
+func setSessionCookie(c *fiber.Ctx, user *models.User) error {
+	token, err := auth.GenerateToken(user.ID, user.Email, user.Name, user.Image, user.Role, user.SessionVersion)
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "nimbledb-test_token",
+		Value:    token,
+		Path:     "/",
+		HTTPOnly: true,
+		Secure:   os.Getenv("IS_PROD") == "true",
+		SameSite: "None",
+		Expires:  time.Now().Add(24 * time.Hour),
+	})
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{maxFailedLogins, time.Minute},
+		{maxFailedLogins + 1, 2 * time.Minute},
+		{maxFailedLogins + 5, 32 * time.Minute},
+		{maxFailedLogins + 6, time.Hour},
+		{maxFailedLogins + 100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.failures); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"backend/internal/repository"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type BookmarkHandler struct {
+	bookmarkRepo *repository.BookmarkRepository
+	postRepo     *repository.PostRepository
+	reactionRepo *repository.ReactionRepository
+}
+
+func NewBookmarkHandler(bookmarkRepo *repository.BookmarkRepository, postRepo *repository.PostRepository, reactionRepo *repository.ReactionRepository) *BookmarkHandler {
+	return &BookmarkHandler{
+		bookmarkRepo: bookmarkRepo,
+		postRepo:     postRepo,
+		reactionRepo: reactionRepo,
+	}
+}
+
+// PutBookmark saves a post for the caller. Saving it twice has no further
+// effect.
+func (h *BookmarkHandler) PutBookmark(c *fiber.Ctx) error {
+	return h.setBookmark(c, h.bookmarkRepo.AddBookmark)
+}
+
+// DeleteBookmark removes a post from the caller's saved posts.
+func (h *BookmarkHandler) DeleteBookmark(c *fiber.Ctx) error {
+	return h.setBookmark(c, h.bookmarkRepo.RemoveBookmark)
+}
+
+func (h *BookmarkHandler) setBookmark(c *fiber.Ctx, apply func(userID, postID int64) error) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	postID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+	}
+
+	post, err := h.postRepo.GetPostByID(postID)
+	if err != nil || !canViewPost(post, userClaims) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+
+	if err := apply(userClaims.UserID, postID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update bookmark: " + err.Error(),
+		})
+	}
+
+	posts := []models.Post{*post}
+	applyViewerReactions(h.reactionRepo, posts, userClaims)
+	applyViewerBookmarks(h.bookmarkRepo, posts, userClaims)
+
+	return c.JSON(fiber.Map{
+		"post": presentPost(&posts[0], userClaims),
+	})
+}
+
+// GetMyBookmarks lists the posts the caller has saved, most recently saved
+// first. Posts that were unpublished or trashed since are left out.
+func (h *BookmarkHandler) GetMyBookmarks(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	page := parsePage(c)
+	posts, err := h.postRepo.GetBookmarkedPosts(userClaims.UserID, page)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch bookmarks: " + err.Error(),
+		})
+	}
+
+	total, err := h.postRepo.CountBookmarkedPosts(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count bookmarks: " + err.Error(),
+		})
+	}
+
+	applyViewerReactions(h.reactionRepo, posts, userClaims)
+	for i := range posts {
+		posts[i].ViewerBookmarked = true
+	}
+
+	return c.JSON(fiber.Map{
+		"posts": presentPosts(posts, userClaims),
+		"pagination": fiber.Map{
+			"limit":  page.Limit,
+			"offset": page.Offset,
+			"total":  total,
+		},
+	})
+}
+
+// applyViewerBookmarks marks which posts the viewer has saved. Like the
+// reaction flags, a failure is logged and leaves the posts unmarked.
+func applyViewerBookmarks(bookmarkRepo *repository.BookmarkRepository, posts []models.Post, viewer *auth.Claims) {
+	if viewer == nil || len(posts) == 0 {
+		return
+	}
+
+	saved, err := bookmarkRepo.GetBookmarkedPostIDs(viewer.UserID)
+	if err != nil {
+		log.Printf("Failed to load bookmarks of user %d: %v", viewer.UserID, err)
+		return
+	}
+
+	for i := range posts {
+		posts[i].ViewerBookmarked = saved[posts[i].ID]
+	}
+}
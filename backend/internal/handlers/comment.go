@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"backend/internal/notify"
+	"backend/internal/repository"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxCommentLength = 2000
+
+type CommentHandler struct {
+	commentRepo *repository.CommentRepository
+	postRepo    *repository.PostRepository
+	notifier    *notify.Service
+}
+
+func NewCommentHandler(commentRepo *repository.CommentRepository, postRepo *repository.PostRepository, notifier *notify.Service) *CommentHandler {
+	return &CommentHandler{
+		commentRepo: commentRepo,
+		postRepo:    postRepo,
+		notifier:    notifier,
+	}
+}
+
+type CreateCommentRequest struct {
+	Content  string `json:"content" validate:"required"`
+	ParentID int64  `json:"parent_id"`
+}
+
+type UpdateCommentRequest struct {
+	Content string `json:"content" validate:"required"`
+}
+
+func (h *CommentHandler) GetComments(c *fiber.Ctx) error {
+	postID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+	}
+
+	viewer := viewerClaims(c)
+	post, err := h.postRepo.GetPostByID(postID)
+	if err != nil || !canViewPost(post, viewer) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+
+	comments, err := h.commentRepo.GetCommentsByPostID(postID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch comments: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"comments": presentCommentTree(comments, viewer),
+		"total":    len(comments),
+	})
+}
+
+func (h *CommentHandler) CreateComment(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	postID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+	}
+
+	var req CreateCommentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	content, msg := validateCommentContent(req.Content)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	post, err := h.postRepo.GetPostByID(postID)
+	if err != nil || !canViewPost(post, userClaims) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+
+	var parent *models.Comment
+	if req.ParentID != 0 {
+		parent, err = h.commentRepo.GetCommentByID(req.ParentID)
+		if err != nil || parent.PostID != postID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Parent comment not found on this post",
+			})
+		}
+	}
+
+	comment, err := h.commentRepo.CreateComment(models.CreateCommentParams{
+		PostID:   postID,
+		UserID:   userClaims.UserID,
+		ParentID: req.ParentID,
+		Content:  content,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create comment: " + err.Error(),
+		})
+	}
+	comment.AuthorName = userClaims.Name
+	comment.AuthorImage = userClaims.Image
+
+	h.notifier.CommentCreated(post, comment, parent)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"comment": presentComment(comment, userClaims),
+	})
+}
+
+func (h *CommentHandler) UpdateComment(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	commentID, ok := h.commentOnPost(c)
+	if !ok {
+		return nil
+	}
+
+	isOwner, err := h.commentRepo.CheckCommentOwnership(commentID, userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Comment not found",
+		})
+	}
+	if !isOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to update this comment",
+		})
+	}
+
+	var req UpdateCommentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	content, msg := validateCommentContent(req.Content)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	if err := h.commentRepo.UpdateComment(commentID, content); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update comment: " + err.Error(),
+		})
+	}
+
+	comment, err := h.commentRepo.GetCommentByID(commentID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch updated comment: " + err.Error(),
+		})
+	}
+	comment.AuthorName = userClaims.Name
+	comment.AuthorImage = userClaims.Image
+
+	return c.JSON(fiber.Map{
+		"comment": presentComment(comment, userClaims),
+	})
+}
+
+func (h *CommentHandler) DeleteComment(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	commentID, ok := h.commentOnPost(c)
+	if !ok {
+		return nil
+	}
+
+	isOwner, err := h.commentRepo.CheckCommentOwnership(commentID, userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Comment not found",
+		})
+	}
+	if !isOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to delete this comment",
+		})
+	}
+
+	if err := h.commentRepo.DeleteComment(commentID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete comment: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Comment deleted successfully",
+	})
+}
+
+// commentOnPost parses the :id and :commentId params and checks that the
+// comment belongs to the post in the URL. On failure it writes the error
+// response and returns false.
+func (h *CommentHandler) commentOnPost(c *fiber.Ctx) (int64, bool) {
+	postID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+		return 0, false
+	}
+
+	commentID, err := strconv.ParseInt(c.Params("commentId"), 10, 64)
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid comment ID",
+		})
+		return 0, false
+	}
+
+	comment, err := h.commentRepo.GetCommentByID(commentID)
+	if err != nil || comment.PostID != postID {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Comment not found",
+		})
+		return 0, false
+	}
+
+	return commentID, true
+}
+
+func validateCommentContent(content string) (string, string) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return "", "Comment content is required"
+	}
+	if len(content) > maxCommentLength {
+		return "", "Comment must be at most 2000 characters"
+	}
+	return content, ""
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"backend/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// postETag is a strong entity tag derived from the post's version, which
+// changes on every update.
+func postETag(post *models.Post) string {
+	return strconv.Quote(strconv.Itoa(post.Version))
+}
+
+// checkIfMatch enforces the If-Match precondition on writes to post. A
+// missing header is answered with 428 and a stale tag with 412; in both
+// cases the response is written and false returned.
+func checkIfMatch(c *fiber.Ctx, post *models.Post) bool {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+			"error": "If-Match header with the post's ETag is required",
+		})
+		return false
+	}
+
+	if header == "*" {
+		return true
+	}
+
+	current := postETag(post)
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+
+	return preconditionFailed(c, post)
+}
+
+// preconditionFailed answers 412 and points the client at the current
+// version so it can refetch and retry.
+func preconditionFailed(c *fiber.Ctx, post *models.Post) bool {
+	if post != nil {
+		c.Set(fiber.HeaderETag, postETag(post))
+	}
+	c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+		"error": "Post was modified since it was fetched, reload it and try again",
+	})
+	return false
+}
+
+// notModified sets the validators of a cacheable response and reports
+// whether the request's conditional headers show the client's copy is still
+// current, in which case it should get a 304. If-None-Match takes
+// precedence over If-Modified-Since and is compared weakly.
+func notModified(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	c.Set(fiber.HeaderETag, etag)
+	if !lastModified.IsZero() {
+		c.Set(fiber.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if header := c.Get(fiber.HeaderIfNoneMatch); header != "" {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	if header := c.Get(fiber.HeaderIfModifiedSince); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"backend/internal/models"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCheckIfMatch(t *testing.T) {
+	post := &models.Post{Version: 3}
+
+	app := fiber.New()
+	app.Put("/", func(c *fiber.Ctx) error {
+		if !checkIfMatch(c, post) {
+			return nil
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	tests := []struct {
+		name     string
+		ifMatch  string
+		want     int
+		wantETag string
+	}{
+		{"missing", "", fiber.StatusPreconditionRequired, ""},
+		{"current", `"3"`, fiber.StatusNoContent, ""},
+		{"any", "*", fiber.StatusNoContent, ""},
+		{"one of several", `"1", "3"`, fiber.StatusNoContent, ""},
+		{"stale", `"2"`, fiber.StatusPreconditionFailed, `"3"`},
+		{"weak tags do not match", `W/"3"`, fiber.StatusPreconditionFailed, `"3"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(fiber.MethodPut, "/", nil)
+			if tt.ifMatch != "" {
+				req.Header.Set(fiber.HeaderIfMatch, tt.ifMatch)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			if etag := resp.Header.Get(fiber.HeaderETag); etag != tt.wantETag {
+				t.Errorf("ETag = %q, want %q", etag, tt.wantETag)
+			}
+		})
+	}
+}
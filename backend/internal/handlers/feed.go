@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"backend/internal/feed"
+	"backend/internal/models"
+	"backend/internal/repository"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// feedSize is how many of the newest posts a feed lists.
+const feedSize = 20
+
+type FeedHandler struct {
+	postRepo *repository.PostRepository
+	userRepo *repository.UserRepository
+	// siteURL is where readers are sent to read a post, and apiURL where
+	// the feeds are served. Either falls back to the URL the request came
+	// in on.
+	siteURL string
+	apiURL  string
+}
+
+func NewFeedHandler(postRepo *repository.PostRepository, userRepo *repository.UserRepository, siteURL, apiURL string) *FeedHandler {
+	return &FeedHandler{
+		postRepo: postRepo,
+		userRepo: userRepo,
+		siteURL:  strings.TrimRight(siteURL, "/"),
+		apiURL:   strings.TrimRight(apiURL, "/"),
+	}
+}
+
+// GetRSS serves the newest published posts as RSS 2.0.
+func (h *FeedHandler) GetRSS(c *fiber.Ctx) error {
+	f, ok := h.timeline(c, 0, "All posts")
+	if !ok {
+		return nil
+	}
+	return h.send(c, f, feed.RSS, "application/rss+xml")
+}
+
+// GetAtom serves the newest published posts as Atom.
+func (h *FeedHandler) GetAtom(c *fiber.Ctx) error {
+	f, ok := h.timeline(c, 0, "All posts")
+	if !ok {
+		return nil
+	}
+	return h.send(c, f, feed.Atom, "application/atom+xml")
+}
+
+// GetUserAtom serves the newest published posts of one author as Atom.
+func (h *FeedHandler) GetUserAtom(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	user, err := h.userRepo.GetUserById(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	f, ok := h.timeline(c, user.ID, "Posts by "+user.Name)
+	if !ok {
+		return nil
+	}
+	return h.send(c, f, feed.Atom, "application/atom+xml")
+}
+
+// timeline builds the feed of userID's posts, or everyone's when userID is
+// 0. On failure it writes the error response and returns false.
+func (h *FeedHandler) timeline(c *fiber.Ctx, userID int64, title string) (*feed.Feed, bool) {
+	posts, err := h.postRepo.GetPublishedPosts(userID, models.Page{Limit: feedSize})
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch posts: " + err.Error(),
+		})
+		return nil, false
+	}
+
+	siteURL := h.siteURL
+	if siteURL == "" {
+		siteURL = c.BaseURL()
+	}
+	apiURL := h.apiURL
+	if apiURL == "" {
+		apiURL = c.BaseURL()
+	}
+
+	f := &feed.Feed{
+		Title:       "NimbleDB Demo: " + title,
+		Description: "Published posts from the NimbleDB demo blog",
+		Link:        siteURL,
+		Self:        apiURL + c.Path(),
+		Entries:     make([]feed.Entry, 0, len(posts)),
+	}
+	for i := range posts {
+		post := &posts[i]
+		link := siteURL + "/posts/" + strconv.FormatInt(post.ID, 10)
+
+		published := post.PublishAt
+		if published.IsZero() {
+			published = post.CreatedAt
+		}
+		updated := feedUpdated(post)
+		if updated.After(f.Updated) {
+			f.Updated = updated
+		}
+
+		f.Entries = append(f.Entries, feed.Entry{
+			ID:         link,
+			Title:      post.Title,
+			Link:       link,
+			Author:     post.AuthorName,
+			Published:  published,
+			Updated:    updated,
+			HTML:       contentRenderer.Post(post),
+			Categories: post.Tags,
+		})
+	}
+	if f.Updated.IsZero() {
+		f.Updated = time.Unix(0, 0)
+	}
+
+	return f, true
+}
+
+// feedUpdated is when post last changed as far as the feed is concerned.
+// Scheduled posts going live do not touch updated_at, so their publish
+// time counts too.
+func feedUpdated(post *models.Post) time.Time {
+	if post.PublishAt.After(post.UpdatedAt) {
+		return post.PublishAt
+	}
+	return post.UpdatedAt
+}
+
+// send encodes f and answers 304 when the client already has this version.
+// The ETag is a hash of the document, so it also changes when a post drops
+// out of the feed, which Last-Modified cannot show.
+func (h *FeedHandler) send(c *fiber.Ctx, f *feed.Feed, encode func(*feed.Feed) ([]byte, error), contentType string) error {
+	body, err := encode(f)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build feed: " + err.Error(),
+		})
+	}
+
+	sum := sha256.Sum256(body)
+	etag := strconv.Quote(hex.EncodeToString(sum[:16]))
+	if notModified(c, etag, f.Updated) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set(fiber.HeaderContentType, contentType+"; charset=utf-8")
+	return c.Send(body)
+}
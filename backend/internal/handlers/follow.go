@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/notify"
+	"backend/internal/repository"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type FollowHandler struct {
+	followRepo *repository.FollowRepository
+	userRepo   *repository.UserRepository
+	notifier   *notify.Service
+}
+
+func NewFollowHandler(followRepo *repository.FollowRepository, userRepo *repository.UserRepository, notifier *notify.Service) *FollowHandler {
+	return &FollowHandler{
+		followRepo: followRepo,
+		userRepo:   userRepo,
+		notifier:   notifier,
+	}
+}
+
+// Follow makes the caller follow the user in the :id param. Following is
+// idempotent.
+func (h *FollowHandler) Follow(c *fiber.Ctx) error {
+	return h.setFollow(c, true)
+}
+
+func (h *FollowHandler) Unfollow(c *fiber.Ctx) error {
+	return h.setFollow(c, false)
+}
+
+func (h *FollowHandler) setFollow(c *fiber.Ctx, follow bool) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	idStr := c.Params("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+	if id == userClaims.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You can't follow yourself",
+		})
+	}
+
+	if _, err := h.userRepo.GetUserById(id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if follow {
+		err = h.followRepo.Follow(userClaims.UserID, id)
+	} else {
+		err = h.followRepo.Unfollow(userClaims.UserID, id)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update follow: " + err.Error(),
+		})
+	}
+	if follow {
+		h.notifier.Followed(userClaims.UserID, id)
+	}
+
+	return c.JSON(fiber.Map{
+		"following": follow,
+	})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/repository"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type NotificationHandler struct {
+	notificationRepo *repository.NotificationRepository
+}
+
+func NewNotificationHandler(notificationRepo *repository.NotificationRepository) *NotificationHandler {
+	return &NotificationHandler{
+		notificationRepo: notificationRepo,
+	}
+}
+
+// UpdateNotificationPreferencesRequest leaves out the kinds that stay as
+// they are.
+type UpdateNotificationPreferencesRequest struct {
+	Comments  *bool `json:"comments"`
+	Replies   *bool `json:"replies"`
+	Reactions *bool `json:"reactions"`
+	Follows   *bool `json:"follows"`
+}
+
+// GetNotifications lists the caller's notifications, newest first, with the
+// number still unread. ?unread=true leaves out the ones already read.
+func (h *NotificationHandler) GetNotifications(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	unreadOnly := c.QueryBool("unread", false)
+	page := parsePage(c)
+
+	notifications, err := h.notificationRepo.GetNotifications(userClaims.UserID, unreadOnly, page)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch notifications: " + err.Error(),
+		})
+	}
+
+	total, err := h.notificationRepo.CountNotifications(userClaims.UserID, unreadOnly)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count notifications: " + err.Error(),
+		})
+	}
+
+	unread := total
+	if !unreadOnly {
+		unread, err = h.notificationRepo.CountNotifications(userClaims.UserID, true)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to count notifications: " + err.Error(),
+			})
+		}
+	}
+
+	views := make([]NotificationView, 0, len(notifications))
+	for i := range notifications {
+		views = append(views, presentNotification(&notifications[i]))
+	}
+
+	return c.JSON(fiber.Map{
+		"notifications": views,
+		"unread_count":  unread,
+		"pagination": fiber.Map{
+			"limit":  page.Limit,
+			"offset": page.Offset,
+			"total":  total,
+		},
+	})
+}
+
+func (h *NotificationHandler) MarkRead(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid notification ID",
+		})
+	}
+
+	found, err := h.notificationRepo.MarkRead(userClaims.UserID, id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update notification: " + err.Error(),
+		})
+	}
+	if !found {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Notification not found",
+		})
+	}
+
+	return h.unreadCount(c, userClaims.UserID)
+}
+
+func (h *NotificationHandler) MarkAllRead(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	if _, err := h.notificationRepo.MarkAllRead(userClaims.UserID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update notifications: " + err.Error(),
+		})
+	}
+
+	return h.unreadCount(c, userClaims.UserID)
+}
+
+// unreadCount answers with what is left unread, so a client can update its
+// badge without listing again.
+func (h *NotificationHandler) unreadCount(c *fiber.Ctx, userID int64) error {
+	unread, err := h.notificationRepo.CountNotifications(userID, true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count notifications: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"unread_count": unread,
+	})
+}
+
+func (h *NotificationHandler) GetPreferences(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	prefs, err := h.notificationRepo.GetPreferences(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch preferences: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"preferences": prefs,
+	})
+}
+
+// UpdatePreferences turns kinds of notification on or off. Turning a kind
+// off stops new notifications of it; ones already received are kept.
+func (h *NotificationHandler) UpdatePreferences(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req UpdateNotificationPreferencesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	prefs, err := h.notificationRepo.GetPreferences(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch preferences: " + err.Error(),
+		})
+	}
+
+	if req.Comments != nil {
+		prefs.Comments = *req.Comments
+	}
+	if req.Replies != nil {
+		prefs.Replies = *req.Replies
+	}
+	if req.Reactions != nil {
+		prefs.Reactions = *req.Reactions
+	}
+	if req.Follows != nil {
+		prefs.Follows = *req.Follows
+	}
+
+	if err := h.notificationRepo.SavePreferences(userClaims.UserID, prefs); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save preferences: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"preferences": prefs,
+	})
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+func parsePage(c *fiber.Ctx) models.Page {
+	limit := c.QueryInt("limit", defaultPageLimit)
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	return models.Page{Limit: limit, Offset: offset}
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"backend/internal/repository"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+// postPatch is a decoded JSON Merge Patch (RFC 7396) for a post.
+type postPatch struct {
+	fields models.PostPatch
+	// tags is nil when the patch leaves tags alone. A null "tags" member
+	// removes every tag and yields an empty, non-nil slice.
+	tags []string
+}
+
+// PatchPost applies a JSON Merge Patch to a post. Only members present in
+// the body are validated and written; absent members keep their value.
+func (h *PostHandler) PatchPost(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	idStr := c.Params("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+	}
+
+	isOwner, err := h.postRepo.CheckPostOwnership(id, userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+	if !isOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to update this post",
+		})
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if mediaType != mergePatchContentType && mediaType != fiber.MIMEApplicationJSON {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": "PATCH expects " + mergePatchContentType,
+		})
+	}
+
+	current, err := h.postRepo.GetPostByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+	if !checkIfMatch(c, current) {
+		return nil
+	}
+
+	patch, err := decodePostPatch(c.Body(), current)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Tags are not a column of posts, but changing them still bumps the
+	// version so the post's ETag moves.
+	changed := !patch.fields.IsEmpty() || patch.tags != nil
+	if changed {
+		err = saveEdit(h.postRepo, h.revisionRepo, current, patch.fields)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			preconditionFailed(c, nil)
+			return nil
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update post: " + err.Error(),
+			})
+		}
+	}
+
+	if patch.tags != nil {
+		if err := h.tagRepo.SetPostTags(id, patch.tags); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save tags: " + err.Error(),
+			})
+		}
+	}
+
+	post, err := h.postRepo.GetPostByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch updated post: " + err.Error(),
+		})
+	}
+	// An empty patch saves nothing, so there is nothing to announce.
+	if changed {
+		h.events.Announce(PostEventUpdated, post, current)
+	}
+
+	c.Set(fiber.HeaderETag, postETag(post))
+	return c.JSON(fiber.Map{
+		"post": presentPost(post, userClaims),
+	})
+}
+
+// decodePostPatch validates each member of a merge patch against current.
+// Unknown members are rejected rather than ignored so a typo does not look
+// like a successful update.
+func decodePostPatch(body []byte, current *models.Post) (*postPatch, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return nil, fmt.Errorf("patch must be a JSON object")
+	}
+
+	patch := &postPatch{}
+	var status string
+	var publishAt *time.Time
+	statusChanged, clearPublishAt := false, false
+
+	for name, raw := range members {
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+		switch name {
+		case "title":
+			var title string
+			if isNull || json.Unmarshal(raw, &title) != nil {
+				return nil, fmt.Errorf("title must be a string")
+			}
+			title, err := validatePostTitle(title)
+			if err != nil {
+				return nil, err
+			}
+			patch.fields.Title = &title
+
+		case "content":
+			var content string
+			if isNull || json.Unmarshal(raw, &content) != nil {
+				return nil, fmt.Errorf("content must be a string")
+			}
+			content, err := validatePostContent(content)
+			if err != nil {
+				return nil, err
+			}
+			patch.fields.Content = &content
+
+		case "tags":
+			tags := []string{}
+			if !isNull {
+				var requested []string
+				if err := json.Unmarshal(raw, &requested); err != nil {
+					return nil, fmt.Errorf("tags must be an array of strings")
+				}
+				normalized, err := normalizeTags(requested)
+				if err != nil {
+					return nil, err
+				}
+				tags = append(tags, normalized...)
+			}
+			patch.tags = tags
+
+		case "format":
+			var format string
+			if isNull || json.Unmarshal(raw, &format) != nil || format == "" {
+				return nil, fmt.Errorf("format must be a string")
+			}
+			format, err := resolvePostFormat(format, current)
+			if err != nil {
+				return nil, err
+			}
+			patch.fields.Format = &format
+
+		case "status":
+			if isNull || json.Unmarshal(raw, &status) != nil || status == "" {
+				return nil, fmt.Errorf("status must be a string")
+			}
+			statusChanged = true
+
+		case "publish_at":
+			if isNull {
+				clearPublishAt = true
+				break
+			}
+			var t time.Time
+			if err := json.Unmarshal(raw, &t); err != nil {
+				return nil, fmt.Errorf("publish_at must be an RFC 3339 timestamp")
+			}
+			publishAt = &t
+
+		default:
+			return nil, fmt.Errorf("unknown or read-only field %q", name)
+		}
+	}
+
+	if statusChanged || publishAt != nil || clearPublishAt {
+		resolved, at, err := resolvePostStatus(status, publishAt, current)
+		if err != nil {
+			return nil, err
+		}
+		// Only scheduled posts keep publish_at, so on any other clearing it
+		// means nothing.
+		if clearPublishAt && resolved != models.PostStatusScheduled {
+			return nil, fmt.Errorf("publish_at can only be set on scheduled posts")
+		}
+		// Removing the publish time of a scheduled post would leave it with
+		// nothing to go live at.
+		if clearPublishAt {
+			return nil, fmt.Errorf("scheduled posts need a publish_at in the future")
+		}
+		patch.fields.Status = &resolved
+		patch.fields.PublishAt = &at
+	}
+
+	return patch, nil
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"backend/internal/models"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodePostPatch(t *testing.T) {
+	future := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	at := `"` + future.Format(time.RFC3339) + `"`
+
+	published := &models.Post{Status: models.PostStatusPublished, PublishAt: time.Unix(1_700_000_000, 0), Format: models.PostFormatPlain}
+	scheduled := &models.Post{Status: models.PostStatusScheduled, PublishAt: future.Add(time.Hour), Format: models.PostFormatPlain}
+	overdue := &models.Post{Status: models.PostStatusScheduled, PublishAt: time.Unix(1_700_000_000, 0), Format: models.PostFormatPlain}
+
+	tests := []struct {
+		name    string
+		current *models.Post
+		body    string
+		wantErr string
+		check   func(t *testing.T, patch *postPatch)
+	}{
+		{
+			name:    "not an object",
+			current: published,
+			body:    `["title"]`,
+			wantErr: "JSON object",
+		},
+		{
+			name:    "unknown member",
+			current: published,
+			body:    `{"titel": "typo"}`,
+			wantErr: `"titel"`,
+		},
+		{
+			name:    "empty patch",
+			current: published,
+			body:    `{}`,
+			check: func(t *testing.T, patch *postPatch) {
+				if !patch.fields.IsEmpty() || patch.tags != nil {
+					t.Errorf("patch = %+v, want nothing changed", patch)
+				}
+			},
+		},
+		{
+			name:    "title is trimmed",
+			current: published,
+			body:    `{"title": "  New title "}`,
+			check: func(t *testing.T, patch *postPatch) {
+				if patch.fields.Title == nil || *patch.fields.Title != "New title" {
+					t.Errorf("title = %v", patch.fields.Title)
+				}
+				if patch.fields.Status != nil {
+					t.Error("status changed without being sent")
+				}
+			},
+		},
+		{
+			name:    "null title",
+			current: published,
+			body:    `{"title": null}`,
+			wantErr: "title must be a string",
+		},
+		{
+			name:    "null tags clear them",
+			current: published,
+			body:    `{"tags": null}`,
+			check: func(t *testing.T, patch *postPatch) {
+				if patch.tags == nil || len(patch.tags) != 0 {
+					t.Errorf("tags = %#v, want empty and non-nil", patch.tags)
+				}
+			},
+		},
+		{
+			name:    "tags are normalized",
+			current: published,
+			body:    `{"tags": ["Go", "#go", "nimble db"]}`,
+			check: func(t *testing.T, patch *postPatch) {
+				if want := []string{"go", "nimble-db"}; !slices.Equal(patch.tags, want) {
+					t.Errorf("tags = %v, want %v", patch.tags, want)
+				}
+			},
+		},
+		{
+			name:    "unknown format",
+			current: published,
+			body:    `{"format": "html"}`,
+			wantErr: "invalid format",
+		},
+		{
+			name:    "draft drops the publish time",
+			current: published,
+			body:    `{"status": "draft"}`,
+			check: func(t *testing.T, patch *postPatch) {
+				if *patch.fields.Status != models.PostStatusDraft || !patch.fields.PublishAt.IsZero() {
+					t.Errorf("status = %s, publish_at = %v", *patch.fields.Status, *patch.fields.PublishAt)
+				}
+			},
+		},
+		{
+			name:    "scheduling a published post",
+			current: published,
+			body:    `{"status": "scheduled", "publish_at": ` + at + `}`,
+			check: func(t *testing.T, patch *postPatch) {
+				if *patch.fields.Status != models.PostStatusScheduled || !patch.fields.PublishAt.Equal(future) {
+					t.Errorf("status = %s, publish_at = %v", *patch.fields.Status, *patch.fields.PublishAt)
+				}
+			},
+		},
+		{
+			name:    "moving a scheduled post",
+			current: scheduled,
+			body:    `{"publish_at": ` + at + `}`,
+			check: func(t *testing.T, patch *postPatch) {
+				if *patch.fields.Status != models.PostStatusScheduled || !patch.fields.PublishAt.Equal(future) {
+					t.Errorf("status = %s, publish_at = %v", *patch.fields.Status, *patch.fields.PublishAt)
+				}
+			},
+		},
+		{
+			name:    "scheduling in the past",
+			current: published,
+			body:    `{"status": "scheduled", "publish_at": "2020-01-01T00:00:00Z"}`,
+			wantErr: "in the future",
+		},
+		{
+			name:    "publish_at on a published post",
+			current: published,
+			body:    `{"publish_at": ` + at + `}`,
+			wantErr: "only be set on scheduled posts",
+		},
+		{
+			name:    "null publish_at on a published post",
+			current: published,
+			body:    `{"publish_at": null}`,
+			wantErr: "only be set on scheduled posts",
+		},
+		{
+			name:    "publish_at with another status",
+			current: scheduled,
+			body:    `{"status": "draft", "publish_at": ` + at + `}`,
+			wantErr: "only be set on scheduled posts",
+		},
+		{
+			name:    "null publish_at on a scheduled post",
+			current: scheduled,
+			body:    `{"publish_at": null}`,
+			wantErr: "in the future",
+		},
+		{
+			name:    "overdue scheduled post is published",
+			current: overdue,
+			body:    `{"status": "scheduled"}`,
+			check: func(t *testing.T, patch *postPatch) {
+				if *patch.fields.Status != models.PostStatusPublished || !patch.fields.PublishAt.Equal(overdue.PublishAt) {
+					t.Errorf("status = %s, publish_at = %v", *patch.fields.Status, *patch.fields.PublishAt)
+				}
+			},
+		},
+		{
+			name:    "bad publish_at",
+			current: scheduled,
+			body:    `{"publish_at": "tomorrow"}`,
+			wantErr: "RFC 3339",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := decodePostPatch([]byte(tt.body), tt.current)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			tt.check(t, patch)
+		})
+	}
+}
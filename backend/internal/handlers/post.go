@@ -2,31 +2,85 @@ package handlers
 
 import (
 	"backend/internal/auth"
+	"backend/internal/jobs"
 	"backend/internal/models"
 	"backend/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 )
 
+// PurgeTrashJob is the kind of job that purges posts which have been in the
+// trash for the retention period. One is queued for every deleted post, due
+// when that post is.
+const PurgeTrashJob = "posts.purge_trash"
+
 type PostHandler struct {
-	postRepo *repository.PostRepository
+	postRepo     *repository.PostRepository
+	reactionRepo *repository.ReactionRepository
+	tagRepo      *repository.TagRepository
+	revisionRepo *repository.RevisionRepository
+	bookmarkRepo *repository.BookmarkRepository
+	events       *PostEvents
+	queue        *jobs.Queue
+	postSocket   fiber.Handler
+
+	trashRetention time.Duration
 }
 
-func NewPostHandler(postRepo *repository.PostRepository) *PostHandler {
-	return &PostHandler{
-		postRepo: postRepo,
+func NewPostHandler(
+	postRepo *repository.PostRepository,
+	reactionRepo *repository.ReactionRepository,
+	tagRepo *repository.TagRepository,
+	revisionRepo *repository.RevisionRepository,
+	bookmarkRepo *repository.BookmarkRepository,
+	events *PostEvents,
+	queue *jobs.Queue,
+	trashRetention time.Duration,
+) *PostHandler {
+	h := &PostHandler{
+		postRepo:       postRepo,
+		reactionRepo:   reactionRepo,
+		tagRepo:        tagRepo,
+		revisionRepo:   revisionRepo,
+		bookmarkRepo:   bookmarkRepo,
+		events:         events,
+		queue:          queue,
+		trashRetention: trashRetention,
 	}
+	h.postSocket = websocket.New(h.servePostSocket)
+	return h
 }
 
 type CreatePostRequest struct {
-	Title   string `json:"title" validate:"required"`
-	Content string `json:"content" validate:"required"`
+	Title     string     `json:"title" validate:"required"`
+	Content   string     `json:"content" validate:"required"`
+	Tags      []string   `json:"tags"`
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+	Format    string     `json:"format"`
 }
 
 type UpdatePostRequest struct {
-	Title   string `json:"title" validate:"required"`
-	Content string `json:"content" validate:"required"`
+	Title     string     `json:"title" validate:"required"`
+	Content   string     `json:"content" validate:"required"`
+	Tags      *[]string  `json:"tags"`
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+	Format    string     `json:"format"`
+}
+
+type PreviewPostRequest struct {
+	Content string `json:"content"`
+	Format  string `json:"format"`
 }
 
 func (h *PostHandler) CreatePost(c *fiber.Ctx) error {
@@ -44,10 +98,41 @@ func (h *PostHandler) CreatePost(c *fiber.Ctx) error {
 		})
 	}
 
+	title, content, err := validatePostText(req.Title, req.Content)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	status, publishAt, err := resolvePostStatus(req.Status, req.PublishAt, nil)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	format, err := resolvePostFormat(req.Format, nil)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	post, err := h.postRepo.CreatePost(models.CreatePostParams{
-		UserID:  userClaims.UserID,
-		Title:   req.Title,
-		Content: req.Content,
+		UserID:    userClaims.UserID,
+		Title:     title,
+		Content:   content,
+		Status:    status,
+		PublishAt: publishAt,
+		Format:    format,
 	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -55,21 +140,108 @@ func (h *PostHandler) CreatePost(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := h.tagRepo.SetPostTags(post.ID, tags); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save tags: " + err.Error(),
+		})
+	}
+	post.Tags = tags
+
+	if _, err := h.revisionRepo.CreateRevision(post.ID, post.Title, post.Content, post.CreatedAt); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save revision: " + err.Error(),
+		})
+	}
+	h.events.Announce(PostEventCreated, post, nil)
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"post": post,
+		"post": presentPost(post, userClaims),
+	})
+}
+
+// PreviewPost renders content the way it would appear once saved, so the
+// editor can show markdown without creating a post.
+func (h *PostHandler) PreviewPost(c *fiber.Ctx) error {
+	var req PreviewPostRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	format, err := resolvePostFormat(req.Format, nil)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if len(req.Content) > maxPostContentLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("content must be at most %d characters", maxPostContentLength),
+		})
+	}
+
+	html, err := contentRenderer.Render(format, req.Content)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to render preview: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"format":       format,
+		"content_html": html,
 	})
 }
 
 func (h *PostHandler) GetAllPosts(c *fiber.Ctx) error {
-	posts, err := h.postRepo.GetAllPosts()
+	sortOrder := c.Query("sort", "recent")
+	if sortOrder != "recent" && sortOrder != "popular" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid sort, expected recent or popular",
+		})
+	}
+
+	tags, err := normalizeTags(queryTags(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	filter := models.PostFilter{Tags: tags}
+	page := parsePage(c)
+
+	var posts []models.Post
+	if sortOrder == "popular" {
+		posts, err = h.postRepo.GetPopularPosts(filter, page)
+	} else {
+		posts, err = h.postRepo.GetAllPosts(filter, page)
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch posts: " + err.Error(),
 		})
 	}
 
+	total, err := h.postRepo.CountPosts(filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count posts: " + err.Error(),
+		})
+	}
+
+	viewer := viewerClaims(c)
+	applyViewerReactions(h.reactionRepo, posts, viewer)
+	applyViewerBookmarks(h.bookmarkRepo, posts, viewer)
+
 	return c.JSON(fiber.Map{
-		"posts": posts,
+		"posts": presentPosts(posts, viewer),
+		"pagination": fiber.Map{
+			"limit":  page.Limit,
+			"offset": page.Offset,
+			"total":  total,
+		},
 	})
 }
 
@@ -82,15 +254,50 @@ func (h *PostHandler) GetPost(c *fiber.Ctx) error {
 		})
 	}
 
+	viewer := viewerClaims(c)
 	post, err := h.postRepo.GetPostByID(id)
+	if err != nil || !canViewPost(post, viewer) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+
+	return h.showPost(c, post, viewer)
+}
+
+// GetPostBySlug looks a post up by its slug. Slugs a post had before its
+// title changed answer with a permanent redirect to the current one.
+func (h *PostHandler) GetPostBySlug(c *fiber.Ctx) error {
+	postSlug := c.Params("slug")
+	viewer := viewerClaims(c)
+
+	post, err := h.postRepo.GetPostBySlug(postSlug)
 	if err != nil {
+		old, err := h.postRepo.GetPostByOldSlug(postSlug)
+		if err == nil && old.Slug != "" && canViewPost(old, viewer) {
+			return c.Redirect("/api/posts/by-slug/"+url.PathEscape(old.Slug), fiber.StatusMovedPermanently)
+		}
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+	if !canViewPost(post, viewer) {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Post not found",
 		})
 	}
 
+	return h.showPost(c, post, viewer)
+}
+
+func (h *PostHandler) showPost(c *fiber.Ctx, post *models.Post, viewer *auth.Claims) error {
+	posts := []models.Post{*post}
+	applyViewerReactions(h.reactionRepo, posts, viewer)
+	applyViewerBookmarks(h.bookmarkRepo, posts, viewer)
+
+	c.Set(fiber.HeaderETag, postETag(post))
 	return c.JSON(fiber.Map{
-		"post": post,
+		"post": presentPost(&posts[0], viewer),
 	})
 }
 
@@ -102,15 +309,62 @@ func (h *PostHandler) GetMyPosts(c *fiber.Ctx) error {
 		})
 	}
 
-	posts, err := h.postRepo.GetPostsByUserID(userClaims.UserID)
+	status := c.Query("status")
+	if status != "" && !models.IsValidPostStatus(status) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid status",
+		})
+	}
+
+	posts, err := h.postRepo.GetPostsByUserID(userClaims.UserID, models.PostFilter{Status: status}, models.Page{})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch posts: " + err.Error(),
 		})
 	}
+	applyViewerReactions(h.reactionRepo, posts, userClaims)
+	applyViewerBookmarks(h.bookmarkRepo, posts, userClaims)
 
 	return c.JSON(fiber.Map{
-		"posts": posts,
+		"posts": presentPosts(posts, viewerClaims(c)),
+	})
+}
+
+// GetFeed returns published posts by the authors the caller follows, newest
+// first.
+func (h *PostHandler) GetFeed(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	page := parsePage(c)
+	posts, err := h.postRepo.GetFeed(userClaims.UserID, page)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch feed: " + err.Error(),
+		})
+	}
+
+	total, err := h.postRepo.CountFeed(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count feed: " + err.Error(),
+		})
+	}
+
+	applyViewerReactions(h.reactionRepo, posts, userClaims)
+	applyViewerBookmarks(h.bookmarkRepo, posts, userClaims)
+
+	return c.JSON(fiber.Map{
+		"posts": presentPosts(posts, userClaims),
+		"pagination": fiber.Map{
+			"limit":  page.Limit,
+			"offset": page.Offset,
+			"total":  total,
+		},
 	})
 }
 
@@ -149,20 +403,84 @@ func (h *PostHandler) UpdatePost(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.postRepo.UpdatePost(id, models.UpdatePostParams{
-		Title:   req.Title,
-		Content: req.Content,
+	current, err := h.postRepo.GetPostByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+	if !checkIfMatch(c, current) {
+		return nil
+	}
+
+	title, content, err := validatePostText(req.Title, req.Content)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	status, publishAt, err := resolvePostStatus(req.Status, req.PublishAt, current)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	format, err := resolvePostFormat(req.Format, current)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var tags []string
+	if req.Tags != nil {
+		tags, err = normalizeTags(*req.Tags)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	err = saveEdit(h.postRepo, h.revisionRepo, current, models.PostPatch{
+		Title:     &title,
+		Content:   &content,
+		Status:    &status,
+		PublishAt: &publishAt,
+		Format:    &format,
 	})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		preconditionFailed(c, nil)
+		return nil
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update post: " + err.Error(),
 		})
 	}
 
-	post, _ := h.postRepo.GetPostByID(id)
+	// Tags are left untouched when the request omits them.
+	if req.Tags != nil {
+		if err := h.tagRepo.SetPostTags(id, tags); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save tags: " + err.Error(),
+			})
+		}
+	}
+
+	post, err := h.postRepo.GetPostByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch updated post: " + err.Error(),
+		})
+	}
+	h.events.Announce(PostEventUpdated, post, current)
 
+	c.Set(fiber.HeaderETag, postETag(post))
 	return c.JSON(fiber.Map{
-		"post": post,
+		"post": presentPost(post, userClaims),
 	})
 }
 
@@ -194,14 +512,232 @@ func (h *PostHandler) DeletePost(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.postRepo.DeletePost(id)
+	post, err := h.postRepo.GetPostByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+	if !checkIfMatch(c, post) {
+		return nil
+	}
+
+	err = h.postRepo.DeletePost(id, post.Version)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		preconditionFailed(c, nil)
+		return nil
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete post: " + err.Error(),
 		})
 	}
 
+	h.events.Announce(PostEventDeleted, post, post)
+
+	if err := h.queue.EnqueueAt(PurgeTrashJob, nil, time.Now().Add(h.trashRetention)); err != nil {
+		log.Printf("Failed to queue purge of post %d: %v", post.ID, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Post moved to trash",
+	})
+}
+
+// PurgeTrash is the handler of PurgeTrashJob. Each run purges every post
+// that is due rather than the one it was queued for, so posts restored
+// since are kept and posts whose job was lost are purged by the next run.
+func (h *PostHandler) PurgeTrash(ctx context.Context, payload []byte) error {
+	purged, err := h.postRepo.PurgeDeletedPosts(time.Now().Add(-h.trashRetention))
+	if purged > 0 {
+		log.Printf("Purged %d posts deleted more than %s ago", purged, h.trashRetention)
+	}
+	return err
+}
+
+// GetTrash lists the caller's deleted posts with the time each one will be
+// purged for good.
+func (h *PostHandler) GetTrash(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	posts, err := h.postRepo.GetDeletedPostsByUserID(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch trash: " + err.Error(),
+		})
+	}
+
+	views := make([]TrashedPostView, 0, len(posts))
+	for i := range posts {
+		views = append(views, presentTrashedPost(&posts[i], userClaims, h.trashRetention))
+	}
+
 	return c.JSON(fiber.Map{
-		"message": "Post deleted successfully",
+		"posts": views,
 	})
 }
+
+func (h *PostHandler) RestorePost(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+	}
+
+	trashed, err := h.postRepo.GetDeletedPostByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found in trash",
+		})
+	}
+	if trashed.UserID != userClaims.UserID {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to restore this post",
+		})
+	}
+
+	err = h.postRepo.RestorePost(id, trashed.Version)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		preconditionFailed(c, nil)
+		return nil
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to restore post: " + err.Error(),
+		})
+	}
+
+	post, err := h.postRepo.GetPostByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch restored post: " + err.Error(),
+		})
+	}
+	// A restored post is not new, so webhooks hear of it as an update. It
+	// was in the trash, so no one else could see it: streams show it to
+	// them as created.
+	h.events.Announce(PostEventUpdated, post, nil)
+
+	c.Set(fiber.HeaderETag, postETag(post))
+	return c.JSON(fiber.Map{
+		"post": presentPost(post, userClaims),
+	})
+}
+
+const (
+	maxPostTitleLength   = 255
+	maxPostContentLength = 5000
+)
+
+// validatePostTitle trims a title and checks it is present and fits the
+// title column.
+func validatePostTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return "", fmt.Errorf("title is required")
+	}
+	if len(title) > maxPostTitleLength {
+		return "", fmt.Errorf("title must be at most %d characters", maxPostTitleLength)
+	}
+	return title, nil
+}
+
+// validatePostContent checks content is not blank and fits the content
+// column. Unlike titles, content is stored as written.
+func validatePostContent(content string) (string, error) {
+	if strings.TrimSpace(content) == "" {
+		return "", fmt.Errorf("content is required")
+	}
+	if len(content) > maxPostContentLength {
+		return "", fmt.Errorf("content must be at most %d characters", maxPostContentLength)
+	}
+	return content, nil
+}
+
+func validatePostText(title, content string) (string, string, error) {
+	title, err := validatePostTitle(title)
+	if err != nil {
+		return "", "", err
+	}
+	content, err = validatePostContent(content)
+	if err != nil {
+		return "", "", err
+	}
+	return title, content, nil
+}
+
+// resolvePostFormat validates format. An empty format keeps the current one,
+// or makes a new post plain text.
+func resolvePostFormat(format string, current *models.Post) (string, error) {
+	if format == "" {
+		if current != nil {
+			return current.Format, nil
+		}
+		return models.PostFormatPlain, nil
+	}
+	if !models.IsValidPostFormat(format) {
+		return "", fmt.Errorf("invalid format, expected plain or markdown")
+	}
+	return format, nil
+}
+
+// resolvePostStatus works out the status and publish time a post ends up with.
+// An empty status keeps the current one, or publishes a new post. Publishing
+// stamps the publish time unless the post was already published, and
+// scheduling requires a publish time in the future. publish_at may only be
+// given for scheduled posts; any other status would drop it.
+func resolvePostStatus(status string, publishAt *time.Time, current *models.Post) (string, time.Time, error) {
+	if status == "" {
+		status = models.PostStatusPublished
+		if current != nil {
+			status = current.Status
+		}
+	}
+	if !models.IsValidPostStatus(status) {
+		return "", time.Time{}, fmt.Errorf("invalid status, expected draft, scheduled, published or archived")
+	}
+	if publishAt != nil && status != models.PostStatusScheduled {
+		return "", time.Time{}, fmt.Errorf("publish_at can only be set on scheduled posts")
+	}
+
+	switch status {
+	case models.PostStatusDraft:
+		return status, time.Time{}, nil
+	case models.PostStatusScheduled:
+		if publishAt == nil && current != nil && current.Status == models.PostStatusScheduled {
+			// The post's time has come but the scheduler has not got to
+			// it yet; it is published as the scheduler would have.
+			if !current.PublishAt.After(time.Now()) {
+				return models.PostStatusPublished, current.PublishAt, nil
+			}
+			publishAt = &current.PublishAt
+		}
+		if publishAt == nil || !publishAt.After(time.Now()) {
+			return "", time.Time{}, fmt.Errorf("scheduled posts need a publish_at in the future")
+		}
+		return status, publishAt.Truncate(time.Second), nil
+	case models.PostStatusPublished:
+		if current != nil && current.Status == models.PostStatusPublished {
+			return status, current.PublishAt, nil
+		}
+		return status, time.Now().Truncate(time.Second), nil
+	default:
+		if current != nil {
+			return status, current.PublishAt, nil
+		}
+		return status, time.Time{}, nil
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"backend/internal/notify"
+	"backend/internal/repository"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ReactionHandler struct {
+	reactionRepo *repository.ReactionRepository
+	postRepo     *repository.PostRepository
+	bookmarkRepo *repository.BookmarkRepository
+	notifier     *notify.Service
+}
+
+func NewReactionHandler(reactionRepo *repository.ReactionRepository, postRepo *repository.PostRepository, bookmarkRepo *repository.BookmarkRepository, notifier *notify.Service) *ReactionHandler {
+	return &ReactionHandler{
+		reactionRepo: reactionRepo,
+		postRepo:     postRepo,
+		bookmarkRepo: bookmarkRepo,
+		notifier:     notifier,
+	}
+}
+
+type ReactionRequest struct {
+	Kind string `json:"kind"`
+}
+
+// PutReaction adds the caller's reaction to a post. Reacting twice with the
+// same kind has no further effect.
+func (h *ReactionHandler) PutReaction(c *fiber.Ctx) error {
+	return h.setReaction(c, true)
+}
+
+// DeleteReaction removes the caller's reaction. Removing a reaction that was
+// never left succeeds as well.
+func (h *ReactionHandler) DeleteReaction(c *fiber.Ctx) error {
+	return h.setReaction(c, false)
+}
+
+func (h *ReactionHandler) setReaction(c *fiber.Ctx, add bool) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	postID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+	}
+
+	// DELETE requests usually carry no body, so the kind may also be given
+	// as a query parameter.
+	var req ReactionRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request",
+			})
+		}
+	}
+	if req.Kind == "" {
+		req.Kind = c.Query("kind", models.ReactionLike)
+	}
+	kind := strings.ToLower(strings.TrimSpace(req.Kind))
+	if !models.IsValidReactionKind(kind) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid reaction kind, expected one of: " + strings.Join(models.ReactionKinds, ", "),
+		})
+	}
+
+	post, err := h.postRepo.GetPostByID(postID)
+	if err != nil || !canViewPost(post, userClaims) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+
+	if add {
+		err = h.reactionRepo.AddReaction(postID, userClaims.UserID, kind)
+	} else {
+		err = h.reactionRepo.RemoveReaction(postID, userClaims.UserID, kind)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update reaction: " + err.Error(),
+		})
+	}
+	if add {
+		h.notifier.ReactionAdded(post, userClaims.UserID, kind)
+	}
+
+	post, err = h.postRepo.GetPostByID(postID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch post: " + err.Error(),
+		})
+	}
+	posts := []models.Post{*post}
+	applyViewerReactions(h.reactionRepo, posts, userClaims)
+	applyViewerBookmarks(h.bookmarkRepo, posts, userClaims)
+
+	return c.JSON(fiber.Map{
+		"post": presentPost(&posts[0], userClaims),
+	})
+}
+
+// applyViewerReactions marks which reactions on posts were left by the viewer.
+// Failures only cost the flags, so they are logged rather than returned.
+func applyViewerReactions(reactionRepo *repository.ReactionRepository, posts []models.Post, viewer *auth.Claims) {
+	if viewer == nil || len(posts) == 0 {
+		return
+	}
+
+	kinds, err := reactionRepo.GetKindsByUserID(viewer.UserID)
+	if err != nil {
+		log.Printf("Failed to load reactions of user %d: %v", viewer.UserID, err)
+		return
+	}
+
+	for i := range posts {
+		posts[i].ViewerReactions = kinds[posts[i].ID]
+	}
+}
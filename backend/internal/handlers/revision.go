@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/diff"
+	"backend/internal/models"
+	"backend/internal/repository"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RevisionHandler struct {
+	revisionRepo *repository.RevisionRepository
+	postRepo     *repository.PostRepository
+	events       *PostEvents
+}
+
+func NewRevisionHandler(revisionRepo *repository.RevisionRepository, postRepo *repository.PostRepository, events *PostEvents) *RevisionHandler {
+	return &RevisionHandler{
+		revisionRepo: revisionRepo,
+		postRepo:     postRepo,
+		events:       events,
+	}
+}
+
+type RevisionSummary struct {
+	Rev       int       `json:"rev"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h *RevisionHandler) GetRevisions(c *fiber.Ctx) error {
+	postID, ok := h.ownedPost(c)
+	if !ok {
+		return nil
+	}
+
+	revisions, err := h.revisionRepo.GetRevisionsByPostID(postID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch revisions: " + err.Error(),
+		})
+	}
+
+	summaries := make([]RevisionSummary, 0, len(revisions))
+	for _, revision := range revisions {
+		summaries = append(summaries, RevisionSummary{
+			Rev:       revision.Rev,
+			Title:     revision.Title,
+			CreatedAt: revision.CreatedAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"revisions": summaries,
+	})
+}
+
+func (h *RevisionHandler) GetRevision(c *fiber.Ctx) error {
+	postID, ok := h.ownedPost(c)
+	if !ok {
+		return nil
+	}
+
+	rev, err := strconv.Atoi(c.Params("rev"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid revision",
+		})
+	}
+
+	revision, err := h.revisionRepo.GetRevision(postID, rev)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Revision not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"revision": revision,
+	})
+}
+
+// DiffRevisions compares revisions ?from= and ?to= line by line. to defaults
+// to the latest revision.
+func (h *RevisionHandler) DiffRevisions(c *fiber.Ctx) error {
+	postID, ok := h.ownedPost(c)
+	if !ok {
+		return nil
+	}
+
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Query parameter from must be a revision number",
+		})
+	}
+
+	to := 0
+	if c.Query("to") != "" {
+		to, err = strconv.Atoi(c.Query("to"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Query parameter to must be a revision number",
+			})
+		}
+	} else {
+		to, err = h.revisionRepo.LatestRev(postID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to fetch revisions: " + err.Error(),
+			})
+		}
+	}
+
+	fromRevision, err := h.revisionRepo.GetRevision(postID, from)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Revision " + strconv.Itoa(from) + " not found",
+		})
+	}
+	toRevision, err := h.revisionRepo.GetRevision(postID, to)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Revision " + strconv.Itoa(to) + " not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"from":    from,
+		"to":      to,
+		"title":   diff.Lines(fromRevision.Title, toRevision.Title),
+		"content": diff.Lines(fromRevision.Content, toRevision.Content),
+	})
+}
+
+// RestoreRevision copies a revision's title and content back onto the post.
+// The restore is itself recorded as a new revision.
+func (h *RevisionHandler) RestoreRevision(c *fiber.Ctx) error {
+	postID, ok := h.ownedPost(c)
+	if !ok {
+		return nil
+	}
+
+	rev, err := strconv.Atoi(c.Params("rev"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid revision",
+		})
+	}
+
+	revision, err := h.revisionRepo.GetRevision(postID, rev)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Revision not found",
+		})
+	}
+
+	current, err := h.postRepo.GetPostByID(postID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+	}
+	// A restore is a plain POST, so If-Match is honoured but not required.
+	if c.Get(fiber.HeaderIfMatch) != "" && !checkIfMatch(c, current) {
+		return nil
+	}
+
+	err = saveEdit(h.postRepo, h.revisionRepo, current, models.PostPatch{
+		Title:   &revision.Title,
+		Content: &revision.Content,
+	})
+	if errors.Is(err, repository.ErrVersionConflict) {
+		preconditionFailed(c, nil)
+		return nil
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to restore revision: " + err.Error(),
+		})
+	}
+
+	post, err := h.postRepo.GetPostByID(postID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch restored post: " + err.Error(),
+		})
+	}
+	h.events.Announce(PostEventUpdated, post, current)
+
+	c.Set(fiber.HeaderETag, postETag(post))
+	return c.JSON(fiber.Map{
+		"post": presentPost(post, viewerClaims(c)),
+	})
+}
+
+// ownedPost parses :id and checks that the caller owns the post. On failure
+// it writes the error response and returns false.
+func (h *RevisionHandler) ownedPost(c *fiber.Ctx) (int64, bool) {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+		return 0, false
+	}
+
+	postID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid post ID",
+		})
+		return 0, false
+	}
+
+	isOwner, err := h.postRepo.CheckPostOwnership(postID, userClaims.UserID)
+	if err != nil {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Post not found",
+		})
+		return 0, false
+	}
+	if !isOwner {
+		c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "You don't have permission to view this post's history",
+		})
+		return 0, false
+	}
+
+	return postID, true
+}
+
+// saveEdit applies patch to current and records the edit in the post's
+// revision history. The new revision is written first and removed again if
+// the update fails, so every edit that lands has its revision. Posts are
+// given rev 1 when created; those written before revisions existed get
+// their current text saved as rev 1 on their first edit. Edits that leave
+// title and content unchanged add no revision.
+func saveEdit(postRepo *repository.PostRepository, revisionRepo *repository.RevisionRepository, current *models.Post, patch models.PostPatch) error {
+	title, content := current.Title, current.Content
+	if patch.Title != nil {
+		title = *patch.Title
+	}
+	if patch.Content != nil {
+		content = *patch.Content
+	}
+
+	var revision *models.PostRevision
+	if title != current.Title || content != current.Content {
+		latest, err := revisionRepo.LatestRev(current.ID)
+		if err != nil {
+			return err
+		}
+		if latest == 0 {
+			if _, err := revisionRepo.CreateRevision(current.ID, current.Title, current.Content, current.UpdatedAt); err != nil {
+				return err
+			}
+		}
+
+		revision, err = revisionRepo.CreateRevision(current.ID, title, content, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := postRepo.PatchPost(current.ID, patch, current.Version); err != nil {
+		if revision != nil {
+			if err := revisionRepo.DeleteRevision(revision.ID); err != nil {
+				log.Printf("Failed to remove revision %d of post %d after a failed edit: %v", revision.Rev, current.ID, err)
+			}
+		}
+		return err
+	}
+
+	return nil
+}
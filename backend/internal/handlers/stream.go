@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"backend/internal/pubsub"
+	"backend/internal/webhook"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	PostEventCreated = "post.created"
+	PostEventUpdated = "post.updated"
+	PostEventDeleted = "post.deleted"
+)
+
+const (
+	// streamBuffer is how many events a stream may fall behind by before
+	// it is dropped and the client has to reconnect.
+	streamBuffer = 32
+	// streamHeartbeat keeps idle streams from being cut by proxies and
+	// finds clients that went away without closing.
+	streamHeartbeat = 15 * time.Second
+	streamWriteWait = 10 * time.Second
+)
+
+// PostEvent is published when a post is created, changed or deleted. Post
+// is its state after the change, or before it for deletions.
+type PostEvent struct {
+	Type string
+	Post *models.Post
+	// WasPublic is whether everyone could see the post before the change.
+	WasPublic bool
+}
+
+func newPostEvent(eventType string, post *models.Post, before *models.Post) PostEvent {
+	return PostEvent{
+		Type:      eventType,
+		Post:      post,
+		WasPublic: before != nil && before.Status == models.PostStatusPublished,
+	}
+}
+
+// PostEvents announces post changes: to open post streams straight away,
+// and to webhooks through the outbox. The post event types double as
+// webhook event types.
+type PostEvents struct {
+	hub      *pubsub.Hub[PostEvent]
+	webhooks *webhook.Dispatcher
+}
+
+func NewPostEvents(hub *pubsub.Hub[PostEvent], webhooks *webhook.Dispatcher) *PostEvents {
+	return &PostEvents{hub: hub, webhooks: webhooks}
+}
+
+// Announce reports a change to post. before is its state before the change,
+// or nil for a post that is new to everyone.
+func (e *PostEvents) Announce(eventType string, post *models.Post, before *models.Post) {
+	e.hub.Publish(newPostEvent(eventType, post, before))
+	queueWebhookEvent(e.webhooks, eventType, presentWebhookPost(post))
+}
+
+// StreamPosts pushes post events to the caller as Server-Sent Events until
+// they disconnect. Each event is named after its type and carries the post
+// as JSON, or just its id for post.deleted. A client that falls too far
+// behind is disconnected and should refetch after reconnecting.
+func (h *PostHandler) StreamPosts(c *fiber.Ctx) error {
+	viewer := viewerClaims(c)
+	sub := h.events.hub.Subscribe(streamBuffer)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+
+		fmt.Fprintf(w, "retry: %d\n\n", streamHeartbeat.Milliseconds())
+		for {
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+			select {
+			case event, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				eventType, data, ok := postEventFor(event, viewer)
+				if !ok {
+					continue
+				}
+				payload, err := json.Marshal(data)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, payload)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+		}
+	})
+	return nil
+}
+
+// StreamPostsSocket is the WebSocket variant of StreamPosts. Every message
+// is a JSON object with the event "type" and its "data".
+func (h *PostHandler) StreamPostsSocket(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return c.Status(fiber.StatusUpgradeRequired).JSON(fiber.Map{
+			"error": "Expected a WebSocket upgrade",
+		})
+	}
+	return h.postSocket(c)
+}
+
+func (h *PostHandler) servePostSocket(conn *websocket.Conn) {
+	viewer, _ := conn.Locals("user").(*auth.Claims)
+	sub := h.events.hub.Subscribe(streamBuffer)
+	defer sub.Close()
+
+	// Nothing the client sends is acted on, but reading is what handles
+	// pongs and notices the client hanging up.
+	gone := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeat))
+	})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "stream ended"),
+					time.Now().Add(streamWriteWait))
+				return
+			}
+			eventType, data, ok := postEventFor(event, viewer)
+			if !ok {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := conn.WriteJSON(fiber.Map{"type": eventType, "data": data}); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// postEventFor decides what viewer is told about event, from their point of
+// view: a post they could not see before is new to them, and one they can
+// no longer see is gone. Viewer-specific fields such as my_reactions are
+// not filled in.
+func postEventFor(event PostEvent, viewer *auth.Claims) (string, any, bool) {
+	post := event.Post
+	sawBefore := event.WasPublic || (viewer != nil && (viewer.UserID == post.UserID || isAdmin(viewer)))
+	gone := fiber.Map{"id": post.ID}
+
+	switch event.Type {
+	case PostEventCreated, PostEventUpdated:
+		if canViewPost(post, viewer) {
+			if event.Type == PostEventUpdated && !sawBefore {
+				return PostEventCreated, presentPost(post, viewer), true
+			}
+			return event.Type, presentPost(post, viewer), true
+		}
+		if event.Type == PostEventUpdated && sawBefore {
+			return PostEventDeleted, gone, true
+		}
+	case PostEventDeleted:
+		if sawBefore {
+			return PostEventDeleted, gone, true
+		}
+	}
+	return "", nil, false
+}
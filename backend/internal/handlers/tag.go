@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"backend/internal/repository"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxTagsPerPost = 10
+	maxTagLength   = 32
+)
+
+type TagHandler struct {
+	tagRepo *repository.TagRepository
+}
+
+func NewTagHandler(tagRepo *repository.TagRepository) *TagHandler {
+	return &TagHandler{
+		tagRepo: tagRepo,
+	}
+}
+
+func (h *TagHandler) GetTags(c *fiber.Ctx) error {
+	tags, err := h.tagRepo.GetTagCounts()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch tags: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"tags": tags,
+	})
+}
+
+// normalizeTags lowercases tags, drops a leading '#', turns inner spaces into
+// dashes and removes duplicates. Tags may only contain letters, digits and
+// dashes.
+func normalizeTags(raw []string) ([]string, error) {
+	seen := make(map[string]bool, len(raw))
+	tags := make([]string, 0, len(raw))
+
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		tag = strings.TrimPrefix(tag, "#")
+		tag = strings.Join(strings.Fields(tag), "-")
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+		for _, r := range tag {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return nil, fmt.Errorf("tag %q may only contain letters, digits and dashes", tag)
+			}
+		}
+
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > maxTagsPerPost {
+		return nil, fmt.Errorf("a post can have at most %d tags", maxTagsPerPost)
+	}
+
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// queryTags collects the repeated ?tag= parameters of the request.
+func queryTags(c *fiber.Ctx) []string {
+	values := c.Context().QueryArgs().PeekMulti("tag")
+
+	tags := make([]string, 0, len(values))
+	for _, value := range values {
+		tags = append(tags, string(value))
+	}
+	return tags
+}
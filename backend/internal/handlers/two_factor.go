@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"backend/internal/totp"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer        = "NimbleDB Demo"
+	recoveryCodeCount = 10
+)
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type TwoFactorLoginRequest struct {
+	PreAuthToken string `json:"pre_auth_token" validate:"required"`
+	Code         string `json:"code" validate:"required"`
+}
+
+func (h *AuthHandler) SetupTwoFactor(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid user claims",
+		})
+	}
+
+	user, err := h.userRepo.GetUserById(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get user",
+		})
+	}
+	if user.TOTPEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate secret",
+		})
+	}
+
+	if err := h.userRepo.SetTOTPSecret(user.ID, secret); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save secret: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, user.Email, secret),
+	})
+}
+
+func (h *AuthHandler) EnableTwoFactor(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid user claims",
+		})
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	user, err := h.userRepo.GetUserById(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get user",
+		})
+	}
+	if user.TOTPEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+	if user.TOTPSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor setup has not been started",
+		})
+	}
+
+	valid, err := h.acceptTOTPCode(user, req.Code)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify code: " + err.Error(),
+		})
+	}
+	if !valid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid verification code",
+		})
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate recovery codes",
+		})
+	}
+
+	if err := h.recoveryCodeRepo.ReplaceCodes(user.ID, hashes); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save recovery codes: " + err.Error(),
+		})
+	}
+
+	if err := h.userRepo.EnableTOTP(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to enable two-factor authentication: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+func (h *AuthHandler) DisableTwoFactor(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid user claims",
+		})
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	user, err := h.userRepo.GetUserById(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get user",
+		})
+	}
+	if !user.TOTPEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor authentication is not enabled",
+		})
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid credentials",
+		})
+	}
+
+	valid, err := h.verifySecondFactor(user, req.Code)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify code: " + err.Error(),
+		})
+	}
+	if !valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid verification code",
+		})
+	}
+
+	if err := h.userRepo.DisableTOTP(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to disable two-factor authentication: " + err.Error(),
+		})
+	}
+	if err := h.recoveryCodeRepo.DeleteByUserID(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete recovery codes: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+func (h *AuthHandler) LoginTwoFactor(c *fiber.Ctx) error {
+	var req TwoFactorLoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	userID, totpStep, err := auth.ValidatePreAuthToken(req.PreAuthToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired login session",
+		})
+	}
+
+	// The step moves on whenever a second factor is accepted, so a token
+	// issued before that has been used already.
+	user, err := h.userRepo.GetUserById(userID)
+	if err != nil || !user.TOTPEnabled || user.TOTPLastStep != totpStep {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired login session",
+		})
+	}
+
+	if time.Now().Before(user.LockedUntil) {
+		return h.rejectLocked(c, user)
+	}
+
+	valid, err := h.verifySecondFactor(user, req.Code)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify code: " + err.Error(),
+		})
+	}
+	if !valid {
+		h.recordLoginFailure(c, user, models.LoginOutcomeInvalidCode)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid verification code",
+		})
+	}
+
+	return h.completeLogin(c, user)
+}
+
+// verifySecondFactor accepts either a TOTP code from a later time step than
+// the last one the user passed with, or one of their unused recovery codes,
+// consuming the recovery code on success. Either way the user's last step
+// moves on, so neither the code nor the pre-auth token it completed can be
+// used again.
+func (h *AuthHandler) verifySecondFactor(user *models.User, code string) (bool, error) {
+	valid, err := h.acceptTOTPCode(user, code)
+	if valid || err != nil {
+		return valid, err
+	}
+
+	codeID, found, err := h.recoveryCodeRepo.FindCode(user.ID, hashRecoveryCode(code))
+	if !found || err != nil {
+		return false, err
+	}
+	// A recovery code has no step of its own. It takes the current one, or
+	// the next if a TOTP code from this step was just accepted. The step is
+	// advanced before the code is used up, so a request that loses the race
+	// for the step leaves the code for another try.
+	advanced, err := h.userRepo.AdvanceTOTPStep(user.ID, user.TOTPLastStep, max(totp.Step(time.Now()), user.TOTPLastStep+1))
+	if !advanced || err != nil {
+		return false, err
+	}
+	return h.recoveryCodeRepo.UseCode(codeID)
+}
+
+// acceptTOTPCode checks code against the user's TOTP secret and records its
+// step as used. A code from a step the user already passed is refused, as is
+// one whose step another request recorded first.
+func (h *AuthHandler) acceptTOTPCode(user *models.User, code string) (bool, error) {
+	step, ok := totp.Match(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return false, nil
+	}
+
+	return h.userRepo.AdvanceTOTPStep(user.ID, user.TOTPLastStep, step)
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+
+		encoded := hex.EncodeToString(raw)
+		code := encoded[:5] + "-" + encoded[5:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"backend/internal/repository"
+	"backend/internal/webhook"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserHandler struct {
+	userRepo         *repository.UserRepository
+	postRepo         *repository.PostRepository
+	commentRepo      *repository.CommentRepository
+	reactionRepo     *repository.ReactionRepository
+	followRepo       *repository.FollowRepository
+	bookmarkRepo     *repository.BookmarkRepository
+	notificationRepo *repository.NotificationRepository
+	loginEventRepo   *repository.LoginEventRepository
+	recoveryCodeRepo *repository.RecoveryCodeRepository
+	accessTokenRepo  *repository.AccessTokenRepository
+	webhooks         *webhook.Dispatcher
+}
+
+func NewUserHandler(
+	userRepo *repository.UserRepository,
+	postRepo *repository.PostRepository,
+	commentRepo *repository.CommentRepository,
+	reactionRepo *repository.ReactionRepository,
+	followRepo *repository.FollowRepository,
+	bookmarkRepo *repository.BookmarkRepository,
+	notificationRepo *repository.NotificationRepository,
+	loginEventRepo *repository.LoginEventRepository,
+	recoveryCodeRepo *repository.RecoveryCodeRepository,
+	accessTokenRepo *repository.AccessTokenRepository,
+	webhooks *webhook.Dispatcher,
+) *UserHandler {
+	return &UserHandler{
+		userRepo:         userRepo,
+		postRepo:         postRepo,
+		commentRepo:      commentRepo,
+		reactionRepo:     reactionRepo,
+		followRepo:       followRepo,
+		bookmarkRepo:     bookmarkRepo,
+		notificationRepo: notificationRepo,
+		loginEventRepo:   loginEventRepo,
+		recoveryCodeRepo: recoveryCodeRepo,
+		accessTokenRepo:  accessTokenRepo,
+		webhooks:         webhooks,
+	}
+}
+
+type UpdateProfileRequest struct {
+	Email *string `json:"email"`
+	Name  *string `json:"name"`
+	Image *string `json:"image"`
+	// CurrentPassword is required to change the email address, which is
+	// what logins go by.
+	CurrentPassword string `json:"current_password"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+func (h *UserHandler) GetUser(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	user, err := h.userRepo.GetUserById(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	viewer := viewerClaims(c)
+	postCount, err := h.postRepo.CountPostsByUserID(user.ID, visiblePostFilter(user.ID, viewer))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count posts: " + err.Error(),
+		})
+	}
+
+	stats, err := h.followStats(user.ID, viewer)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count follows: " + err.Error(),
+		})
+	}
+	stats.PostCount = postCount
+
+	return c.JSON(fiber.Map{
+		"user": presentUser(user, stats, viewer),
+	})
+}
+
+func (h *UserHandler) followStats(userID int64, viewer *auth.Claims) (*UserStats, error) {
+	followers, err := h.followRepo.GetFollowerIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	following, err := h.followRepo.GetFollowingIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &UserStats{
+		FollowerCount:  len(followers),
+		FollowingCount: len(following),
+	}
+	if viewer != nil {
+		stats.FollowedByMe = slices.Contains(followers, viewer.UserID)
+	}
+	return stats, nil
+}
+
+func (h *UserHandler) GetUserPosts(c *fiber.Ctx) error {
+	idStr := c.Params("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	if _, err := h.userRepo.GetUserById(id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	viewer := viewerClaims(c)
+	filter := visiblePostFilter(id, viewer)
+
+	page := parsePage(c)
+	posts, err := h.postRepo.GetPostsByUserID(id, filter, page)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch posts: " + err.Error(),
+		})
+	}
+
+	total, err := h.postRepo.CountPostsByUserID(id, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count posts: " + err.Error(),
+		})
+	}
+
+	applyViewerReactions(h.reactionRepo, posts, viewer)
+	applyViewerBookmarks(h.bookmarkRepo, posts, viewer)
+
+	return c.JSON(fiber.Map{
+		"posts": presentPosts(posts, viewer),
+		"pagination": fiber.Map{
+			"limit":  page.Limit,
+			"offset": page.Offset,
+			"total":  total,
+		},
+	})
+}
+
+func (h *UserHandler) UpdateMe(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req UpdateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	user, err := h.userRepo.GetUserById(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get user",
+		})
+	}
+
+	params := models.UpdateUserParams{
+		Email: user.Email,
+		Name:  user.Name,
+		Image: user.Image,
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if len(name) > 255 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Name must be at most 255 characters",
+			})
+		}
+		params.Name = name
+	}
+
+	if req.Image != nil {
+		image := strings.TrimSpace(*req.Image)
+		if !isHTTPURL(image) || len(image) > 500 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Image must be an http(s) URL of at most 500 characters",
+			})
+		}
+		params.Image = image
+	}
+
+	if req.Email != nil {
+		email := strings.TrimSpace(*req.Email)
+		if !strings.Contains(email, "@") || len(email) > 255 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid email address",
+			})
+		}
+		if email != user.Email {
+			if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)) != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Current password is incorrect",
+				})
+			}
+			if existing, err := h.userRepo.GetUserByEmail(email); err == nil && existing.ID != user.ID {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "Email already registered",
+				})
+			}
+		}
+		params.Email = email
+	}
+
+	if err := h.userRepo.UpdateUser(user.ID, params); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update profile: " + err.Error(),
+		})
+	}
+
+	user.Email = params.Email
+	user.Name = params.Name
+	user.Image = params.Image
+
+	// The session JWT carries the profile fields, so it is reissued to keep
+	// them in sync. Access tokens look the user up on every request instead.
+	if !userClaims.IsAccessToken() {
+		if err := setSessionCookie(c, user); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate token",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"user": presentUser(user, nil, userClaims),
+	})
+}
+
+func (h *UserHandler) DeleteMe(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req DeleteAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	user, err := h.userRepo.GetUserById(userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get user",
+		})
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid credentials",
+		})
+	}
+
+	if err := h.postRepo.DeletePostsByUserID(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete posts: " + err.Error(),
+		})
+	}
+
+	cleanups := []func(int64) error{
+		h.commentRepo.DeleteCommentsByUserID,
+		h.reactionRepo.DeleteByUserID,
+		h.followRepo.DeleteByUserID,
+		h.bookmarkRepo.DeleteByUserID,
+		h.notificationRepo.DeleteByUserID,
+		h.accessTokenRepo.DeleteTokensByUserID,
+		h.recoveryCodeRepo.DeleteByUserID,
+		h.loginEventRepo.DeleteByUserID,
+	}
+	for _, cleanup := range cleanups {
+		if err := cleanup(user.ID); err != nil {
+			log.Printf("Failed to clean up data of deleted user %d: %v", user.ID, err)
+		}
+	}
+
+	if err := h.userRepo.DeleteUser(user.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete account: " + err.Error(),
+		})
+	}
+
+	queueWebhookEvent(h.webhooks, models.WebhookUserDeleted, presentWebhookUser(user))
+
+	clearSessionCookie(c)
+
+	return c.JSON(fiber.Map{
+		"message": "Account deleted successfully",
+	})
+}
+
+func clearSessionCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "nimbledb-test_token",
+		Value:    "",
+		Path:     "/",
+		HTTPOnly: true,
+		SameSite: "None",
+		Expires:  time.Unix(0, 0),
+	})
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
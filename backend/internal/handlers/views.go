@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"backend/internal/render"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Handlers never return models structs directly. Each resource has a public
+// view, an owner view with the fields only the owner may see, and an admin
+// view. The present* functions pick the view from the caller's claims.
+
+// contentRenderer caches the HTML of the most recently shown post versions.
+var contentRenderer = render.New(1000)
+
+type PostView struct {
+	ID           int64          `json:"id"`
+	UserID       int64          `json:"user_id"`
+	Title        string         `json:"title"`
+	Slug         string         `json:"slug"`
+	Content      string         `json:"content"`
+	Format       string         `json:"format"`
+	ContentHTML  string         `json:"content_html"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	AuthorName   string         `json:"author_name,omitempty"`
+	AuthorImage  string         `json:"author_image,omitempty"`
+	PublishAt    *time.Time     `json:"publish_at,omitempty"`
+	Version      int            `json:"version"`
+	Tags         []string       `json:"tags"`
+	CommentCount int            `json:"comment_count"`
+	Reactions    map[string]int `json:"reactions"`
+	LikedByMe    bool           `json:"liked_by_me"`
+	MyReactions  []string       `json:"my_reactions"`
+	Bookmarked   bool           `json:"bookmarked"`
+}
+
+type OwnerPostView struct {
+	PostView
+	IsOwner bool   `json:"is_owner"`
+	Status  string `json:"status"`
+}
+
+type AdminPostView struct {
+	OwnerPostView
+	AuthorEmail string `json:"author_email,omitempty"`
+}
+
+type TrashedPostView struct {
+	OwnerPostView
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+type AttachmentView struct {
+	ID           int64     `json:"id"`
+	PostID       int64     `json:"post_id"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type UserView struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Image     string    `json:"image"`
+	CreatedAt time.Time `json:"created_at"`
+	*UserStats
+}
+
+type UserStats struct {
+	PostCount      int  `json:"post_count"`
+	FollowerCount  int  `json:"follower_count"`
+	FollowingCount int  `json:"following_count"`
+	FollowedByMe   bool `json:"followed_by_me"`
+}
+
+type OwnerUserView struct {
+	UserView
+	Email            string `json:"email"`
+	Role             string `json:"role"`
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+}
+
+type AdminUserView struct {
+	OwnerUserView
+	FailedLogins int        `json:"failed_logins"`
+	LockedUntil  *time.Time `json:"locked_until"`
+}
+
+func viewerClaims(c *fiber.Ctx) *auth.Claims {
+	claims, _ := c.Locals("user").(*auth.Claims)
+	return claims
+}
+
+func isAdmin(viewer *auth.Claims) bool {
+	return viewer != nil && viewer.IsAdmin()
+}
+
+// canViewPost reports whether viewer may read post. Only published posts are
+// public; drafts, scheduled and archived posts are visible to their author
+// and to admins.
+func canViewPost(post *models.Post, viewer *auth.Claims) bool {
+	if post.Status == models.PostStatusPublished {
+		return true
+	}
+	return viewer != nil && (viewer.UserID == post.UserID || isAdmin(viewer))
+}
+
+// visiblePostFilter limits listings of userID's posts to what viewer may see.
+func visiblePostFilter(userID int64, viewer *auth.Claims) models.PostFilter {
+	if viewer != nil && (viewer.UserID == userID || isAdmin(viewer)) {
+		return models.PostFilter{}
+	}
+	return models.PostFilter{Status: models.PostStatusPublished}
+}
+
+func presentPost(post *models.Post, viewer *auth.Claims) any {
+	isOwner := viewer != nil && viewer.UserID == post.UserID
+	ownerView := ownerPostView(post, isOwner)
+
+	switch {
+	case isAdmin(viewer):
+		return AdminPostView{
+			OwnerPostView: ownerView,
+			AuthorEmail:   post.AuthorEmail,
+		}
+	case isOwner:
+		return ownerView
+	default:
+		return ownerView.PostView
+	}
+}
+
+func ownerPostView(post *models.Post, isOwner bool) OwnerPostView {
+	view := PostView{
+		ID:           post.ID,
+		UserID:       post.UserID,
+		Title:        post.Title,
+		Slug:         post.Slug,
+		Content:      post.Content,
+		Format:       post.Format,
+		ContentHTML:  contentRenderer.Post(post),
+		CreatedAt:    post.CreatedAt,
+		UpdatedAt:    post.UpdatedAt,
+		AuthorName:   post.AuthorName,
+		AuthorImage:  post.AuthorImage,
+		Version:      post.Version,
+		Tags:         post.Tags,
+		CommentCount: post.CommentCount,
+		Reactions:    post.ReactionCounts,
+		MyReactions:  post.ViewerReactions,
+		Bookmarked:   post.ViewerBookmarked,
+	}
+	if !post.PublishAt.IsZero() {
+		view.PublishAt = &post.PublishAt
+	}
+	if view.Tags == nil {
+		view.Tags = []string{}
+	}
+	if view.Reactions == nil {
+		view.Reactions = map[string]int{}
+	}
+	if view.MyReactions == nil {
+		view.MyReactions = []string{}
+	}
+	for _, kind := range view.MyReactions {
+		if kind == models.ReactionLike {
+			view.LikedByMe = true
+		}
+	}
+
+	return OwnerPostView{
+		PostView: view,
+		IsOwner:  isOwner,
+		Status:   post.Status,
+	}
+}
+
+func presentTrashedPost(post *models.Post, viewer *auth.Claims, retention time.Duration) TrashedPostView {
+	return TrashedPostView{
+		OwnerPostView: ownerPostView(post, viewer != nil && viewer.UserID == post.UserID),
+		DeletedAt:     post.DeletedAt,
+		PurgeAt:       post.DeletedAt.Add(retention),
+	}
+}
+
+func presentPosts(posts []models.Post, viewer *auth.Claims) []any {
+	views := make([]any, 0, len(posts))
+	for i := range posts {
+		views = append(views, presentPost(&posts[i], viewer))
+	}
+	return views
+}
+
+func presentUser(user *models.User, stats *UserStats, viewer *auth.Claims) any {
+	view := UserView{
+		ID:        user.ID,
+		Name:      user.Name,
+		Image:     user.Image,
+		CreatedAt: user.CreatedAt,
+		UserStats: stats,
+	}
+
+	ownerView := OwnerUserView{
+		UserView:         view,
+		Email:            user.Email,
+		Role:             user.Role,
+		TwoFactorEnabled: user.TOTPEnabled,
+	}
+
+	switch {
+	case isAdmin(viewer):
+		adminView := AdminUserView{
+			OwnerUserView: ownerView,
+			FailedLogins:  user.FailedLogins,
+		}
+		if !user.LockedUntil.IsZero() {
+			adminView.LockedUntil = &user.LockedUntil
+		}
+		return adminView
+	case viewer != nil && viewer.UserID == user.ID:
+		return ownerView
+	default:
+		return view
+	}
+}
+
+type CommentView struct {
+	ID          int64          `json:"id"`
+	PostID      int64          `json:"post_id"`
+	UserID      int64          `json:"user_id"`
+	ParentID    *int64         `json:"parent_id"`
+	Content     string         `json:"content"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	AuthorName  string         `json:"author_name,omitempty"`
+	AuthorImage string         `json:"author_image,omitempty"`
+	IsOwner     bool           `json:"is_owner"`
+	Replies     []*CommentView `json:"replies"`
+}
+
+func presentComment(comment *models.Comment, viewer *auth.Claims) *CommentView {
+	view := &CommentView{
+		ID:          comment.ID,
+		PostID:      comment.PostID,
+		UserID:      comment.UserID,
+		Content:     comment.Content,
+		CreatedAt:   comment.CreatedAt,
+		UpdatedAt:   comment.UpdatedAt,
+		AuthorName:  comment.AuthorName,
+		AuthorImage: comment.AuthorImage,
+		IsOwner:     viewer != nil && viewer.UserID == comment.UserID,
+		Replies:     []*CommentView{},
+	}
+	if comment.ParentID != 0 {
+		view.ParentID = &comment.ParentID
+	}
+	return view
+}
+
+// presentCommentTree nests replies under their parents. Comments whose parent
+// is gone (e.g. its author deleted their account) are shown at the top level.
+func presentCommentTree(comments []models.Comment, viewer *auth.Claims) []*CommentView {
+	views := make(map[int64]*CommentView, len(comments))
+	for i := range comments {
+		views[comments[i].ID] = presentComment(&comments[i], viewer)
+	}
+
+	roots := make([]*CommentView, 0)
+	for i := range comments {
+		view := views[comments[i].ID]
+		parent, ok := views[comments[i].ParentID]
+		if comments[i].ParentID == 0 || !ok {
+			roots = append(roots, view)
+			continue
+		}
+		parent.Replies = append(parent.Replies, view)
+	}
+	return roots
+}
+
+// presentAttachment shows an attachment served at fileURL. Attachments have
+// no owner-only fields; who may see them at all is decided by their post.
+func presentAttachment(attachment *models.Attachment, fileURL string) AttachmentView {
+	view := AttachmentView{
+		ID:          attachment.ID,
+		PostID:      attachment.PostID,
+		Filename:    attachment.Filename,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		Width:       attachment.Width,
+		Height:      attachment.Height,
+		URL:         fileURL,
+		CreatedAt:   attachment.CreatedAt,
+	}
+	if attachment.ThumbnailKey != "" {
+		view.ThumbnailURL = fileURL + "/thumbnail"
+	}
+	return view
+}
+
+type NotificationView struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	ActorID    int64      `json:"actor_id"`
+	ActorName  string     `json:"actor_name,omitempty"`
+	ActorImage string     `json:"actor_image,omitempty"`
+	PostID     int64      `json:"post_id,omitempty"`
+	PostTitle  string     `json:"post_title,omitempty"`
+	PostSlug   string     `json:"post_slug,omitempty"`
+	CommentID  int64      `json:"comment_id,omitempty"`
+	Reaction   string     `json:"reaction,omitempty"`
+	Read       bool       `json:"read"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// presentNotification shows a notification to its recipient, the only one
+// who can see it.
+func presentNotification(n *models.Notification) NotificationView {
+	view := NotificationView{
+		ID:         n.ID,
+		Kind:       n.Kind,
+		ActorID:    n.ActorID,
+		ActorName:  n.ActorName,
+		ActorImage: n.ActorImage,
+		PostID:     n.PostID,
+		PostTitle:  n.PostTitle,
+		PostSlug:   n.PostSlug,
+		CommentID:  n.CommentID,
+		Read:       n.IsRead(),
+		CreatedAt:  n.CreatedAt,
+	}
+	if n.Kind == models.NotificationReaction {
+		view.Reaction = n.Detail
+	}
+	if n.IsRead() {
+		view.ReadAt = &n.ReadAt
+	}
+	return view
+}
+
+// maxWebhookTextLength is how many bytes of a title or name webhook events
+// carry. json.Marshal may escape each byte as six, and the whole event has
+// to fit the outbox's payload column; receivers that need the full text
+// fetch the post or profile.
+const maxWebhookTextLength = 100
+
+// WebhookPostView is a post as sent to webhooks. Content is left out to keep
+// events small; receivers that need it fetch the post.
+type WebhookPostView struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	Title     string     `json:"title"`
+	Slug      string     `json:"slug"`
+	Status    string     `json:"status"`
+	Format    string     `json:"format"`
+	Version   int        `json:"version"`
+	Tags      []string   `json:"tags"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// presentWebhookPost shows a post to webhook receivers, which are set up by
+// administrators and so hear about drafts too.
+func presentWebhookPost(post *models.Post) WebhookPostView {
+	view := WebhookPostView{
+		ID:        post.ID,
+		UserID:    post.UserID,
+		Title:     clipText(post.Title, maxWebhookTextLength),
+		Slug:      post.Slug,
+		Status:    post.Status,
+		Format:    post.Format,
+		Version:   post.Version,
+		Tags:      post.Tags,
+		CreatedAt: post.CreatedAt,
+		UpdatedAt: post.UpdatedAt,
+	}
+	if view.Tags == nil {
+		view.Tags = []string{}
+	}
+	if !post.PublishAt.IsZero() {
+		view.PublishAt = &post.PublishAt
+	}
+	return view
+}
+
+// WebhookUserView is an account as sent to webhooks. The image URL is left
+// out: at up to 500 bytes, escaped, it would not fit the outbox.
+type WebhookUserView struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// presentWebhookUser shows an account to webhook receivers: only what its
+// public profile shows.
+func presentWebhookUser(user *models.User) WebhookUserView {
+	return WebhookUserView{
+		ID:        user.ID,
+		Name:      clipText(user.Name, maxWebhookTextLength),
+		CreatedAt: user.CreatedAt,
+	}
+}
+
+// clipText shortens s to at most max bytes without splitting a character.
+func clipText(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/models"
+	"backend/internal/repository"
+	"backend/internal/webhook"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const webhookSecretPrefix = "whsec_"
+
+type WebhookHandler struct {
+	webhookRepo *repository.WebhookRepository
+	webhooks    *webhook.Dispatcher
+}
+
+func NewWebhookHandler(webhookRepo *repository.WebhookRepository, webhooks *webhook.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{
+		webhookRepo: webhookRepo,
+		webhooks:    webhooks,
+	}
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// UpdateWebhookRequest leaves out the fields that stay as they are.
+type UpdateWebhookRequest struct {
+	URL    *string   `json:"url"`
+	Events *[]string `json:"events"`
+	Active *bool     `json:"active"`
+}
+
+// webhookPayload is the JSON body of every webhook request. The event's id
+// is sent in the X-Webhook-Event-Id header.
+type webhookPayload struct {
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// queueWebhookEvent puts an event in the webhook outbox and queues it for
+// delivery. NimbleDB has no transactions, so this runs right after the
+// change it describes is saved rather than atomically with it; if it fails
+// the change stands and the event is lost, which is logged.
+func queueWebhookEvent(webhooks *webhook.Dispatcher, eventType string, data any) {
+	payload, err := json.Marshal(webhookPayload{
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+	if err == nil {
+		err = webhooks.Publish(eventType, string(payload))
+	}
+	if err != nil {
+		log.Printf("Failed to queue %s webhook event: %v", eventType, err)
+	}
+}
+
+// CreateWebhook subscribes a URL to events. The signing secret is only ever
+// shown in this response.
+func (h *WebhookHandler) CreateWebhook(c *fiber.Ctx) error {
+	userClaims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req CreateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	if !validWebhook(c, req.URL, req.Events) {
+		return nil
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate secret",
+		})
+	}
+	secret := webhookSecretPrefix + hex.EncodeToString(raw)
+
+	webhook, err := h.webhookRepo.CreateWebhook(req.URL, secret, req.Events, userClaims.UserID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create webhook: " + err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"webhook": webhook,
+		"secret":  secret,
+	})
+}
+
+func (h *WebhookHandler) GetWebhooks(c *fiber.Ctx) error {
+	webhooks, err := h.webhookRepo.GetWebhooks()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch webhooks: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"webhooks": webhooks,
+	})
+}
+
+func (h *WebhookHandler) GetWebhook(c *fiber.Ctx) error {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return nil
+	}
+
+	return c.JSON(fiber.Map{
+		"webhook": webhook,
+	})
+}
+
+// UpdateWebhook changes a webhook's URL or events, or pauses it. Pending
+// deliveries of a paused webhook go to the dead-letter list when they come
+// due.
+func (h *WebhookHandler) UpdateWebhook(c *fiber.Ctx) error {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return nil
+	}
+
+	var req UpdateWebhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request",
+		})
+	}
+
+	if req.URL != nil {
+		webhook.URL = *req.URL
+	}
+	if req.Events != nil {
+		webhook.Events = *req.Events
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+
+	if !validWebhook(c, webhook.URL, webhook.Events) {
+		return nil
+	}
+
+	if err := h.webhookRepo.UpdateWebhook(webhook); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update webhook: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"webhook": webhook,
+	})
+}
+
+// DeleteWebhook removes a webhook along with its delivery log.
+func (h *WebhookHandler) DeleteWebhook(c *fiber.Ctx) error {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return nil
+	}
+
+	if err := h.webhookRepo.DeleteWebhook(webhook.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete webhook: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// GetDeliveries is a webhook's delivery log, newest first. ?status= narrows
+// it to pending, succeeded or dead deliveries.
+func (h *WebhookHandler) GetDeliveries(c *fiber.Ctx) error {
+	webhook, ok := h.findWebhook(c)
+	if !ok {
+		return nil
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", models.DeliveryPending, models.DeliverySucceeded, models.DeliveryDead:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unknown delivery status: " + status,
+		})
+	}
+
+	return h.listDeliveries(c, webhook.ID, status)
+}
+
+// GetDeadLetters lists the deliveries of every webhook that failed all their
+// attempts, newest first.
+func (h *WebhookHandler) GetDeadLetters(c *fiber.Ctx) error {
+	return h.listDeliveries(c, 0, models.DeliveryDead)
+}
+
+// RetryDelivery queues a delivery to be sent again straight away, with a
+// fresh set of attempts. Deliveries already sent are left alone.
+func (h *WebhookHandler) RetryDelivery(c *fiber.Ctx) error {
+	id, err := strconv.ParseInt(c.Params("deliveryId"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid delivery ID",
+		})
+	}
+
+	delivery, err := h.webhookRepo.GetDeliveryByID(id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Delivery not found",
+		})
+	}
+	if delivery.Status == models.DeliverySucceeded {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Delivery already succeeded",
+		})
+	}
+
+	if err := h.webhooks.Retry(delivery); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retry delivery: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"delivery": delivery,
+	})
+}
+
+func (h *WebhookHandler) listDeliveries(c *fiber.Ctx, webhookID int64, status string) error {
+	page := parsePage(c)
+
+	deliveries, err := h.webhookRepo.GetDeliveries(webhookID, status, page)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch deliveries: " + err.Error(),
+		})
+	}
+
+	total, err := h.webhookRepo.CountDeliveries(webhookID, status)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count deliveries: " + err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"deliveries": deliveries,
+		"pagination": fiber.Map{
+			"limit":  page.Limit,
+			"offset": page.Offset,
+			"total":  total,
+		},
+	})
+}
+
+func (h *WebhookHandler) findWebhook(c *fiber.Ctx) (*models.Webhook, bool) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid webhook ID",
+		})
+		return nil, false
+	}
+
+	webhook, err := h.webhookRepo.GetWebhookByID(id)
+	if err != nil {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Webhook not found",
+		})
+		return nil, false
+	}
+	return webhook, true
+}
+
+func validWebhook(c *fiber.Ctx, url string, events []string) bool {
+	if !isHTTPURL(url) || len(url) > 500 {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "url must be an http or https URL",
+		})
+		return false
+	}
+	if len(events) == 0 {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one event is required",
+		})
+		return false
+	}
+	for _, event := range events {
+		if !models.IsValidWebhookEventType(event) {
+			c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Unknown event: " + event,
+			})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"backend/internal/models"
+	"backend/internal/webhook"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookEventsFitTheOutbox(t *testing.T) {
+	// json.Marshal escapes "<" as \u003c: six bytes, the longest escape.
+	worstText := strings.Repeat("<", 255)
+	worstTime := time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.FixedZone("", -12*3600))
+
+	tags := make([]string, maxTagsPerPost)
+	for i := range tags {
+		tags[i] = strings.Repeat("x", maxTagLength)
+	}
+	post := &models.Post{
+		ID:        math.MaxInt64,
+		UserID:    math.MaxInt64,
+		Title:     worstText,
+		Slug:      strings.Repeat("x", 100),
+		Status:    models.PostStatusScheduled,
+		Format:    models.PostFormatMarkdown,
+		Version:   math.MaxInt64,
+		Tags:      tags,
+		PublishAt: worstTime,
+		CreatedAt: worstTime,
+		UpdatedAt: worstTime,
+	}
+	user := &models.User{ID: math.MaxInt64, Name: worstText, CreatedAt: worstTime}
+
+	tests := []struct {
+		name string
+		data any
+	}{
+		{"post", presentWebhookPost(post)},
+		{"user", presentWebhookUser(user)},
+	}
+	for _, tt := range tests {
+		for _, eventType := range models.WebhookEventTypes {
+			payload, err := json.Marshal(webhookPayload{Type: eventType, OccurredAt: worstTime, Data: tt.data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(payload) > webhook.MaxPayloadLength {
+				t.Errorf("%s %s event is %d bytes, the outbox holds %d", tt.name, eventType, len(payload), webhook.MaxPayloadLength)
+			}
+		}
+	}
+}
+
+func TestClipText(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly", 7, "exactly"},
+		{"truncated", 5, "trunc"},
+		{"naïve", 3, "na"},
+		{"日本", 4, "日"},
+	}
+	for _, tt := range tests {
+		if got := clipText(tt.s, tt.max); got != tt.want {
+			t.Errorf("clipText(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
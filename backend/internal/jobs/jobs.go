@@ -0,0 +1,384 @@
+// Package jobs runs background work from a queue kept in NimbleDB, so slow
+// work can leave the request that caused it, survives restarts and is
+// shared by every API instance.
+//
+// A worker takes a job by leasing it: the job's run_at is pushed to the end
+// of the lease, and renewed while the job runs. If the worker dies, the
+// lease runs out and another worker picks the job up again. Failed jobs are
+// retried with exponential backoff until they run out of attempts and are
+// left in the table as dead.
+package jobs
+
+import (
+	"backend/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Handler does the work of one kind of job. It should stop when ctx is
+// cancelled; the job is then put back in the queue.
+type Handler func(ctx context.Context, payload []byte) error
+
+// Store is the storage the queue needs. It is satisfied by
+// repository.JobRepository.
+type Store interface {
+	CreateJob(job *models.Job) error
+	GetDueJobs(now time.Time, limit int) ([]models.Job, error)
+	UpdateJob(job *models.Job, from time.Time) (bool, error)
+	DeleteJob(id int64) error
+}
+
+type Config struct {
+	// Concurrency is how many jobs this process runs at once.
+	Concurrency int
+	// PollInterval is how often idle workers look for due jobs. Jobs
+	// enqueued by this process wake a worker straight away.
+	PollInterval time.Duration
+	// Lease is how long a job is hidden from other workers once taken, and
+	// so how soon the job of a crashed worker is retried. It is renewed
+	// every half lease while the job runs.
+	Lease time.Duration
+	// MaxAttempts is how many times a job is tried before it is dead.
+	MaxAttempts int
+}
+
+const (
+	defaultConcurrency  = 4
+	defaultPollInterval = time.Second
+	defaultLease        = time.Minute
+	defaultMaxAttempts  = 5
+
+	firstRetry = 10 * time.Second
+	maxRetry   = time.Hour
+
+	// releaseWait is how long Drain waits, after giving up on running jobs,
+	// for them to be put back in the queue.
+	releaseWait = time.Second
+)
+
+type Queue struct {
+	store    Store
+	cfg      Config
+	handlers map[string]Handler
+	now      func() time.Time
+	wake     chan struct{}
+
+	mu      sync.Mutex
+	running bool
+	stop    chan struct{}
+	// ctx is cancelled when Drain stops waiting for running jobs.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a queue backed by store. Zero fields of cfg get defaults.
+func New(store Store, cfg Config) *Queue {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultConcurrency
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	// Leases are stored in whole seconds, and renewing must move them.
+	if cfg.Lease < 2*time.Second {
+		cfg.Lease = defaultLease
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		store:    store,
+		cfg:      cfg,
+		handlers: make(map[string]Handler),
+		now:      time.Now,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Handle registers the handler for jobs of kind. Handlers must be
+// registered before Start.
+func (q *Queue) Handle(kind string, handler Handler) {
+	q.handlers[kind] = handler
+}
+
+// Enqueue adds a job to run as soon as a worker is free. payload is stored
+// as JSON and handed to the handler as such.
+func (q *Queue) Enqueue(kind string, payload any) error {
+	return q.EnqueueAt(kind, payload, q.now())
+}
+
+// EnqueueAt adds a job that is not run before runAt.
+func (q *Queue) EnqueueAt(kind string, payload any, runAt time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode %s job: %w", kind, err)
+	}
+
+	job := &models.Job{
+		Kind:        kind,
+		Payload:     string(data),
+		MaxAttempts: q.cfg.MaxAttempts,
+		RunAt:       seconds(runAt),
+	}
+	if err := q.store.CreateJob(job); err != nil {
+		return fmt.Errorf("enqueue %s job: %w", kind, err)
+	}
+
+	if !job.RunAt.After(q.now()) {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Start starts the workers.
+func (q *Queue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.running {
+		return
+	}
+	q.running = true
+
+	for range q.cfg.Concurrency {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Drain stops workers from taking new jobs and waits for running ones to
+// finish. If ctx expires first, running jobs are cancelled and put back in
+// the queue for the next process, and ctx's error is returned.
+func (q *Queue) Drain(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.running {
+		q.mu.Unlock()
+		return nil
+	}
+	q.running = false
+	close(q.stop)
+	q.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		select {
+		case <-stopped:
+		case <-time.After(releaseWait):
+		}
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	poll := time.NewTicker(q.cfg.PollInterval)
+	defer poll.Stop()
+
+	for {
+		for q.runNext() {
+			select {
+			case <-q.stop:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-poll.C:
+		}
+	}
+}
+
+// runNext leases and runs one due job, reporting whether there was one.
+func (q *Queue) runNext() bool {
+	due, err := q.store.GetDueJobs(q.now(), q.cfg.Concurrency)
+	if err != nil {
+		log.Printf("Failed to fetch due jobs: %v", err)
+		return false
+	}
+
+	for i := range due {
+		job := &due[i]
+		from := job.RunAt
+		job.Attempts++
+		job.RunAt = seconds(q.now().Add(q.cfg.Lease))
+
+		leased, err := q.store.UpdateJob(job, from)
+		if err != nil {
+			log.Printf("Failed to lease job %d: %v", job.ID, err)
+			return false
+		}
+		if leased {
+			q.run(job)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Queue) run(job *models.Job) {
+	// Attempts counts leases, so a job whose worker keeps dying on it runs
+	// out of attempts like one that keeps failing.
+	if job.Attempts > job.MaxAttempts {
+		job.Attempts--
+		q.fail(job, errors.New("lease expired on the last attempt"))
+		return
+	}
+
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		q.fail(job, fmt.Errorf("no handler for %s jobs", job.Kind))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(q.ctx)
+	renewed := make(chan bool, 1)
+	go func() { renewed <- q.renew(ctx, cancel, job) }()
+
+	err := call(ctx, handler, []byte(job.Payload))
+	cancel()
+	if !<-renewed {
+		log.Printf("Lost the lease on job %d (%s); another worker has it", job.ID, job.Kind)
+		return
+	}
+
+	switch {
+	case err == nil:
+		if err := q.store.DeleteJob(job.ID); err != nil {
+			log.Printf("Failed to delete finished job %d: %v", job.ID, err)
+		}
+	case q.ctx.Err() != nil:
+		q.release(job, err)
+	default:
+		q.fail(job, err)
+	}
+}
+
+// renew extends job's lease every half lease until ctx is done. If the
+// lease cannot be renewed the job is cancelled and renew reports false.
+func (q *Queue) renew(ctx context.Context, cancel context.CancelFunc, job *models.Job) bool {
+	ticker := time.NewTicker(q.cfg.Lease / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-ticker.C:
+			from := job.RunAt
+			job.RunAt = seconds(q.now().Add(q.cfg.Lease))
+			renewed, err := q.store.UpdateJob(job, from)
+			if err != nil {
+				// The lease may still be good; try again next tick.
+				job.RunAt = from
+				log.Printf("Failed to renew the lease on job %d: %v", job.ID, err)
+				continue
+			}
+			if !renewed {
+				cancel()
+				return false
+			}
+		}
+	}
+}
+
+// fail records a failed attempt and schedules the next, or gives up on the
+// job if it was the last or the error is permanent.
+func (q *Queue) fail(job *models.Job, err error) {
+	leasedUntil := job.RunAt
+	job.LastError = err.Error()
+
+	var permanent *permanentError
+	if job.Attempts >= job.MaxAttempts || errors.As(err, &permanent) {
+		job.Status = models.JobDead
+		log.Printf("Job %d (%s) failed for good after %d attempts: %v", job.ID, job.Kind, job.Attempts, err)
+	} else {
+		job.RunAt = seconds(q.now().Add(Backoff(firstRetry, maxRetry, job.Attempts)))
+	}
+
+	if _, err := q.store.UpdateJob(job, leasedUntil); err != nil {
+		log.Printf("Failed to save job %d: %v", job.ID, err)
+	}
+}
+
+// release puts back a job that was cancelled by shutdown. The interrupted
+// run does not count as an attempt.
+func (q *Queue) release(job *models.Job, err error) {
+	leasedUntil := job.RunAt
+	job.Attempts--
+	job.RunAt = seconds(q.now())
+	job.LastError = err.Error()
+
+	if _, err := q.store.UpdateJob(job, leasedUntil); err != nil {
+		log.Printf("Failed to release job %d: %v", job.ID, err)
+	}
+}
+
+// call runs handler, turning a panic into an error so one bad job can't
+// take the process down.
+func call(ctx context.Context, handler Handler, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, payload)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, such as a payload that cannot
+// be decoded. A handler returning it sends the job straight to dead.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Backoff is how long to wait after the given failed attempt, counting
+// from 1: first, doubling each time, at most limit. Failed jobs wait 10s at
+// first and at most an hour.
+func Backoff(first, limit time.Duration, attempt int) time.Duration {
+	wait := first
+	for i := 1; i < attempt && wait < limit; i++ {
+		wait *= 2
+	}
+	return min(wait, limit)
+}
+
+// seconds drops the sub-second part of t, which run_at does not store, so
+// that leases compare equal to what was written.
+func seconds(t time.Time) time.Time {
+	return time.Unix(t.Unix(), 0)
+}
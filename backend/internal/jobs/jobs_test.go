@@ -0,0 +1,323 @@
+package jobs
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[int64]models.Job
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{jobs: make(map[int64]models.Job)}
+}
+
+func (m *memoryStore) CreateJob(job *models.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	job.ID = m.nextID
+	job.Status = models.JobPending
+	m.jobs[job.ID] = *job
+	return nil
+}
+
+func (m *memoryStore) GetDueJobs(now time.Time, limit int) ([]models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []models.Job
+	for _, job := range m.jobs {
+		if job.Status == models.JobPending && !job.RunAt.After(now) {
+			due = append(due, job)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].RunAt.Before(due[j].RunAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (m *memoryStore) UpdateJob(job *models.Job, from time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.jobs[job.ID]
+	if !ok || stored.Status != models.JobPending || !stored.RunAt.Equal(from) {
+		return false, nil
+	}
+	m.jobs[job.ID] = *job
+	return true, nil
+}
+
+func (m *memoryStore) DeleteJob(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.jobs, id)
+	return nil
+}
+
+func (m *memoryStore) only(t *testing.T) models.Job {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.jobs) != 1 {
+		t.Fatalf("store holds %d jobs, want 1", len(m.jobs))
+	}
+	for _, job := range m.jobs {
+		return job
+	}
+	panic("unreachable")
+}
+
+// testQueue returns a queue whose clock is under the test's control. Its
+// workers are not started: tests call runNext to run one job.
+func testQueue(store Store) (*Queue, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	q := New(store, Config{MaxAttempts: 3})
+	q.now = func() time.Time { return now }
+	return q, &now
+}
+
+func TestRunsJobsAndDeletesThem(t *testing.T) {
+	store := newMemoryStore()
+	q, _ := testQueue(store)
+
+	var got string
+	q.Handle("greet", func(ctx context.Context, payload []byte) error {
+		got = string(payload)
+		return nil
+	})
+
+	if err := q.Enqueue("greet", map[string]string{"name": "ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if !q.runNext() {
+		t.Fatal("runNext found no job")
+	}
+	if got != `{"name":"ann"}` {
+		t.Errorf("payload = %s", got)
+	}
+	if len(store.jobs) != 0 {
+		t.Errorf("finished job was not deleted: %+v", store.jobs)
+	}
+	if q.runNext() {
+		t.Error("job ran twice")
+	}
+}
+
+func TestDelayedJobWaitsForRunAt(t *testing.T) {
+	store := newMemoryStore()
+	q, now := testQueue(store)
+
+	ran := false
+	q.Handle("later", func(ctx context.Context, payload []byte) error {
+		ran = true
+		return nil
+	})
+
+	if err := q.EnqueueAt("later", nil, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if q.runNext() || ran {
+		t.Fatal("delayed job ran early")
+	}
+
+	*now = now.Add(time.Minute)
+	if !q.runNext() || !ran {
+		t.Error("delayed job did not run once due")
+	}
+}
+
+func TestFailedJobsBackOffThenDie(t *testing.T) {
+	store := newMemoryStore()
+	q, now := testQueue(store)
+
+	calls := 0
+	q.Handle("flaky", func(ctx context.Context, payload []byte) error {
+		calls++
+		return errors.New("boom")
+	})
+	q.Enqueue("flaky", nil)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if !q.runNext() {
+			t.Fatalf("attempt %d did not run", attempt)
+		}
+		job := store.only(t)
+		if job.Attempts != attempt || job.LastError != "boom" {
+			t.Fatalf("after attempt %d: %+v", attempt, job)
+		}
+		if attempt == 3 {
+			if job.Status != models.JobDead {
+				t.Errorf("status = %q after the last attempt, want dead", job.Status)
+			}
+			break
+		}
+		if wait := job.RunAt.Sub(*now); wait != Backoff(firstRetry, maxRetry, attempt) {
+			t.Errorf("attempt %d retries in %v, want %v", attempt, wait, Backoff(firstRetry, maxRetry, attempt))
+		}
+		if q.runNext() {
+			t.Fatal("retried before the backoff elapsed")
+		}
+		*now = job.RunAt
+	}
+
+	*now = now.Add(24 * time.Hour)
+	if q.runNext() || calls != 3 {
+		t.Errorf("dead job ran again (%d calls)", calls)
+	}
+}
+
+func TestPermanentErrorsAreNotRetried(t *testing.T) {
+	store := newMemoryStore()
+	q, _ := testQueue(store)
+
+	q.Handle("bad", func(ctx context.Context, payload []byte) error {
+		return Permanent(errors.New("bad payload"))
+	})
+	q.Enqueue("bad", nil)
+	q.runNext()
+
+	if job := store.only(t); job.Status != models.JobDead || job.Attempts != 1 {
+		t.Errorf("job = %+v, want dead after one attempt", job)
+	}
+}
+
+func TestExpiredLeaseIsRetried(t *testing.T) {
+	store := newMemoryStore()
+	q, now := testQueue(store)
+
+	// A worker leased the job and died: its lease ran out a second ago.
+	store.CreateJob(&models.Job{Kind: "work", Attempts: 1, MaxAttempts: 3, RunAt: now.Add(-time.Second)})
+
+	ran := false
+	q.Handle("work", func(ctx context.Context, payload []byte) error {
+		ran = true
+		return nil
+	})
+	if !q.runNext() || !ran {
+		t.Fatal("job with an expired lease was not picked up")
+	}
+
+	// One whose workers keep dying runs out of attempts.
+	store.CreateJob(&models.Job{Kind: "work", Attempts: 3, MaxAttempts: 3, RunAt: now.Add(-time.Second)})
+	ran = false
+	q.runNext()
+	if job := store.only(t); ran || job.Status != models.JobDead || job.Attempts != 3 {
+		t.Errorf("job = %+v, ran = %v; want dead without running", job, ran)
+	}
+}
+
+func TestLeaseHidesRunningJobs(t *testing.T) {
+	store := newMemoryStore()
+	q, now := testQueue(store)
+	other, _ := testQueue(store)
+	other.now = q.now
+
+	q.Handle("work", func(ctx context.Context, payload []byte) error {
+		if other.runNext() {
+			t.Error("another worker took a leased job")
+		}
+		return errors.New("retry me")
+	})
+	q.Enqueue("work", nil)
+	q.runNext()
+
+	if job := store.only(t); job.Attempts != 1 || !job.RunAt.After(*now) {
+		t.Errorf("job = %+v", job)
+	}
+}
+
+func TestDrainWaitsForRunningJobs(t *testing.T) {
+	store := newMemoryStore()
+	q := New(store, Config{Concurrency: 2, PollInterval: 10 * time.Millisecond})
+
+	started := make(chan struct{})
+	q.Handle("slow", func(ctx context.Context, payload []byte) error {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	q.Start()
+	q.Enqueue("slow", nil)
+	<-started
+
+	if err := q.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if len(store.jobs) != 0 {
+		t.Error("Drain returned before the running job finished")
+	}
+}
+
+func TestDrainReleasesJobsThatOutlastIt(t *testing.T) {
+	store := newMemoryStore()
+	q := New(store, Config{PollInterval: 10 * time.Millisecond})
+
+	started := make(chan struct{})
+	q.Handle("stuck", func(ctx context.Context, payload []byte) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	q.Start()
+	q.Enqueue("stuck", nil)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain = %v, want the deadline error", err)
+	}
+
+	job := store.only(t)
+	if job.Status != models.JobPending || job.Attempts != 0 || job.RunAt.After(time.Now()) {
+		t.Errorf("job = %+v, want it pending and due with no attempt counted", job)
+	}
+}
+
+func TestPanickingHandlerFailsTheJob(t *testing.T) {
+	store := newMemoryStore()
+	q, _ := testQueue(store)
+
+	q.Handle("panic", func(ctx context.Context, payload []byte) error {
+		panic("oops")
+	})
+	q.Enqueue("panic", nil)
+	q.runNext()
+
+	if job := store.only(t); job.LastError != "panic: oops" {
+		t.Errorf("last error = %q", job.LastError)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(firstRetry, maxRetry, tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package media inspects uploaded files and makes thumbnails of images.
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"mime"
+	"net/http"
+
+	// Decoders for the image formats uploads may use.
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxPixels bounds the images that get decoded, so a small file claiming
+// huge dimensions can't exhaust memory.
+const maxPixels = 40_000_000
+
+var allowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// Sniff returns the media type of data judged by its content, ignoring
+// whatever the client claimed, without parameters such as charset.
+func Sniff(data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// IsAllowed reports whether files of contentType may be uploaded.
+func IsAllowed(contentType string) bool {
+	return allowedTypes[contentType]
+}
+
+// IsImage reports whether contentType is an image Thumbnail can read.
+func IsImage(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Dimensions reads an image's width and height from its header, without
+// decoding it, and checks that Thumbnail would accept it.
+func Dimensions(data []byte) (width, height int, err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("unreadable image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return 0, 0, fmt.Errorf("image dimensions %dx%d are not supported", config.Width, config.Height)
+	}
+	return config.Width, config.Height, nil
+}
+
+// Thumbnail decodes an image and returns a JPEG no larger than maxSide on
+// either side, along with the original dimensions. Transparent areas are
+// flattened onto white.
+func Thumbnail(data []byte, maxSide int) (thumb []byte, width, height int, err error) {
+	if _, _, err := Dimensions(data); err != nil {
+		return nil, 0, 0, err
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("unreadable image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height = bounds.Dx(), bounds.Dy()
+	w, h := fit(width, height, maxSide)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), width, height, nil
+}
+
+// fit scales w x h down to fit in a maxSide square, keeping the aspect
+// ratio. Images that already fit are left at their size.
+func fit(w, h, maxSide int) (int, int) {
+	if w <= maxSide && h <= maxSide {
+		return w, h
+	}
+	if w >= h {
+		return maxSide, max(1, h*maxSide/w)
+	}
+	return max(1, w*maxSide/h), maxSide
+}
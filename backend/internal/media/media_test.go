@@ -0,0 +1,97 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.NRGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"png", encodePNG(t, 2, 2), "image/png"},
+		{"pdf", []byte("%PDF-1.7\n..."), "application/pdf"},
+		{"text", []byte("just some notes"), "text/plain"},
+		{"html", []byte("<!DOCTYPE html><html><script>alert(1)</script>"), "text/html"},
+	}
+	for _, tt := range tests {
+		if got := Sniff(tt.data); got != tt.want {
+			t.Errorf("Sniff(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if IsAllowed("text/html") {
+		t.Error("IsAllowed(text/html) = true, want false")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	thumb, w, h, err := Thumbnail(encodePNG(t, 800, 400), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 800 || h != 400 {
+		t.Errorf("original size = %dx%d, want 800x400", w, h)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if got := img.Bounds().Size(); got.X != 200 || got.Y != 100 {
+		t.Errorf("thumbnail size = %v, want 200x100", got)
+	}
+}
+
+func TestThumbnailKeepsSmallImages(t *testing.T) {
+	thumb, _, _, err := Thumbnail(encodePNG(t, 50, 80), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got.X != 50 || got.Y != 80 {
+		t.Errorf("thumbnail size = %v, want 50x80", got)
+	}
+}
+
+func TestThumbnailRejectsGarbage(t *testing.T) {
+	if _, _, _, err := Thumbnail([]byte("not an image"), 200); err == nil {
+		t.Error("Thumbnail() of garbage succeeded, want an error")
+	}
+}
+
+func TestDimensions(t *testing.T) {
+	w, h, err := Dimensions(encodePNG(t, 30, 20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 30 || h != 20 {
+		t.Errorf("Dimensions() = %dx%d, want 30x20", w, h)
+	}
+
+	if _, _, err := Dimensions([]byte("not an image")); err == nil {
+		t.Error("Dimensions() of garbage succeeded, want an error")
+	}
+}
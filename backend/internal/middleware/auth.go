@@ -2,25 +2,175 @@ package middleware
 
 import (
 	"backend/internal/auth"
+	"backend/internal/repository"
+	"crypto/sha256"
+	"encoding/hex"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func AuthMiddleware(c *fiber.Ctx) error {
-	token := c.Cookies("nimbledb-test_token")
-	log.Println("Token", token)
-	if token == "" {
+const AccessTokenPrefix = "ndb_pat_"
+
+// NewAuthMiddleware authenticates requests with the session cookie, or with
+// an "Authorization: Bearer" header carrying either a session JWT or a
+// personal access token.
+func NewAuthMiddleware(tokenRepo *repository.AccessTokenRepository, userRepo *repository.UserRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := authenticate(c, tokenRepo, userRepo)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+
+		c.Locals("user", claims)
+		return c.Next()
+	}
+}
+
+// NewOptionalAuthMiddleware sets the caller's claims when the request carries
+// valid credentials, and lets anonymous requests through unchanged. Public
+// endpoints use it to tailor responses to the caller, which includes showing
+// owners their unpublished posts, so an access token without the posts:read
+// scope is treated as anonymous.
+func NewOptionalAuthMiddleware(tokenRepo *repository.AccessTokenRepository, userRepo *repository.UserRepository) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if claims, err := authenticate(c, tokenRepo, userRepo); err == nil && claims.HasScope(auth.ScopePostsRead) {
+			c.Locals("user", claims)
+		}
+		return c.Next()
+	}
+}
+
+func RequireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("user").(*auth.Claims)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Unauthorized",
+			})
+		}
+		if !claims.HasScope(scope) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Token is missing the " + scope + " scope",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// RequireSession rejects personal access tokens, for endpoints such as token
+// management and two-factor settings that only the account owner may use.
+func RequireSession(c *fiber.Ctx) error {
+	claims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Unauthorized",
 		})
 	}
-	claims, err := auth.ValidateToken(token)
-	if err != nil {
+	if claims.IsAccessToken() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "This endpoint cannot be used with an access token",
+		})
+	}
+	return c.Next()
+}
+
+// RequireAdmin limits an endpoint to administrators.
+func RequireAdmin(c *fiber.Ctx) error {
+	claims, ok := c.Locals("user").(*auth.Claims)
+	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Unauthorized",
 		})
 	}
-	c.Locals("user", claims)
+	if !claims.IsAdmin() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Administrator access required",
+		})
+	}
 	return c.Next()
 }
+
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func authenticate(c *fiber.Ctx, tokenRepo *repository.AccessTokenRepository, userRepo *repository.UserRepository) (*auth.Claims, error) {
+	token := c.Cookies("nimbledb-test_token")
+	if bearer := bearerToken(c); bearer != "" {
+		token = bearer
+	}
+	if token == "" {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	if strings.HasPrefix(token, AccessTokenPrefix) {
+		return accessTokenClaims(token, tokenRepo, userRepo)
+	}
+	return sessionClaims(token, userRepo)
+}
+
+// sessionClaims validates a session token. Its signature alone would keep it
+// good for a day, so the user is loaded as well: the session ends with the
+// account or when the password changes.
+func sessionClaims(token string, userRepo *repository.UserRepository) (*auth.Claims, error) {
+	claims, err := auth.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := userRepo.GetUserById(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.SessionVersion != claims.SessionVersion {
+		return nil, fiber.ErrUnauthorized
+	}
+	return claims, nil
+}
+
+func bearerToken(c *fiber.Ctx) string {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+func accessTokenClaims(token string, tokenRepo *repository.AccessTokenRepository, userRepo *repository.UserRepository) (*auth.Claims, error) {
+	accessToken, err := tokenRepo.GetTokenByHash(HashAccessToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(accessToken.ExpiresAt) {
+		return nil, fiber.ErrUnauthorized
+	}
+
+	user, err := userRepo.GetUserById(accessToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only record usage once a minute so that busy scripts don't turn every
+	// request into a write.
+	if accessToken.LastUsedAt == nil || time.Since(*accessToken.LastUsedAt) > time.Minute {
+		if err := tokenRepo.TouchToken(accessToken.ID); err != nil {
+			log.Printf("Failed to update last use of access token %d: %v", accessToken.ID, err)
+		}
+	}
+
+	return &auth.Claims{
+		Email:         user.Email,
+		UserID:        user.ID,
+		Name:          user.Name,
+		Image:         user.Image,
+		Role:          user.Role,
+		AccessTokenID: accessToken.ID,
+		Scopes:        accessToken.Scopes,
+	}, nil
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"backend/internal/auth"
+	"backend/internal/ratelimit"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RateLimitConfig struct {
+	Name       string
+	Store      ratelimit.Store
+	PerIP      ratelimit.Limit
+	PerAccount ratelimit.Limit
+}
+
+// RateLimit throttles requests with one token bucket per client IP and one per
+// account. The account is the authenticated user when the route sits behind
+// AuthMiddleware, otherwise the email in the request body (login, register).
+func RateLimit(cfg RateLimitConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var results []ratelimit.Result
+		var limits []ratelimit.Limit
+
+		if cfg.PerIP.Enabled() {
+			key := fmt.Sprintf("%s:ip:%s", cfg.Name, c.IP())
+			result, err := cfg.Store.Take(key, cfg.PerIP)
+			if err != nil {
+				log.Printf("Rate limit store error: %v", err)
+				return c.Next()
+			}
+			results = append(results, result)
+			limits = append(limits, cfg.PerIP)
+		}
+
+		if account := accountKey(c); account != "" && cfg.PerAccount.Enabled() {
+			key := fmt.Sprintf("%s:account:%s", cfg.Name, account)
+			result, err := cfg.Store.Take(key, cfg.PerAccount)
+			if err != nil {
+				log.Printf("Rate limit store error: %v", err)
+				return c.Next()
+			}
+			results = append(results, result)
+			limits = append(limits, cfg.PerAccount)
+		}
+
+		if len(results) == 0 {
+			return c.Next()
+		}
+
+		strictest := 0
+		for i, result := range results {
+			if !result.Allowed && results[strictest].Allowed {
+				strictest = i
+			} else if result.Allowed == results[strictest].Allowed && result.Remaining < results[strictest].Remaining {
+				strictest = i
+			}
+		}
+		result := results[strictest]
+		limit := limits[strictest]
+
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset.Seconds())))
+		c.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Burst, ceilSeconds(limit.Per.Seconds())))
+
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.RetryAfter.Seconds())))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many requests",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+func accountKey(c *fiber.Ctx) string {
+	if claims, ok := c.Locals("user").(*auth.Claims); ok {
+		return "user:" + strconv.FormatInt(claims.UserID, 10)
+	}
+
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Email == "" {
+		return ""
+	}
+	return "email:" + strings.ToLower(strings.TrimSpace(body.Email))
+}
+
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
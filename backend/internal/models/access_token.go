@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+type AccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAccessTokenParams struct {
+	UserID    int64
+	Name      string
+	TokenHash string
+	Scopes    []string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Attachment is an uploaded file. PostID is 0 for files that belong to the
+// user rather than a post, such as avatars.
+type Attachment struct {
+	ID          int64     `json:"id"`
+	PostID      int64     `json:"post_id"`
+	UserID      int64     `json:"user_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// StorageKey and ThumbnailKey locate the blobs in the blob store.
+	// ThumbnailKey is empty for files that are not images.
+	StorageKey   string `json:"-"`
+	ThumbnailKey string `json:"-"`
+}
+
+type CreateAttachmentParams struct {
+	PostID       int64
+	UserID       int64
+	Filename     string
+	ContentType  string
+	Size         int64
+	Width        int
+	Height       int
+	StorageKey   string
+	ThumbnailKey string
+}
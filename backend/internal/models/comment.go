@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type Comment struct {
+	ID        int64     `json:"id"`
+	PostID    int64     `json:"post_id"`
+	UserID    int64     `json:"user_id"`
+	ParentID  int64     `json:"parent_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	AuthorName  string `json:"author_name,omitempty"`
+	AuthorImage string `json:"author_image,omitempty"`
+}
+
+type CreateCommentParams struct {
+	PostID   int64
+	UserID   int64
+	ParentID int64
+	Content  string
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+const (
+	JobPending = "pending"
+	// JobDead marks a job that failed every attempt. Dead jobs stay in the
+	// table for inspection and are never run again.
+	JobDead = "dead"
+)
+
+// Job is a unit of background work. Jobs that succeed are deleted, so every
+// stored job is either pending or dead.
+type Job struct {
+	ID          int64
+	Kind        string
+	Payload     string
+	Status      string
+	Attempts    int
+	MaxAttempts int
+	// RunAt is when a pending job is next due. While a worker holds the job
+	// it is the end of the worker's lease: if the worker dies, the job comes
+	// due again then.
+	RunAt     time.Time
+	LastError string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
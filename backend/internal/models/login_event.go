@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	LoginOutcomeSuccess         = "success"
+	LoginOutcomeInvalidPassword = "invalid_password"
+	LoginOutcomeInvalidCode     = "invalid_2fa_code"
+	LoginOutcomeLocked          = "locked"
+)
+
+type LoginEvent struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Outcome   string    `json:"outcome"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateLoginEventParams struct {
+	UserID    int64
+	IP        string
+	UserAgent string
+	Outcome   string
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+const (
+	NotificationComment  = "comment"
+	NotificationReply    = "reply"
+	NotificationReaction = "reaction"
+	NotificationFollow   = "follow"
+)
+
+type Notification struct {
+	ID          int64  `json:"id"`
+	RecipientID int64  `json:"recipient_id"`
+	ActorID     int64  `json:"actor_id"`
+	Kind        string `json:"kind"`
+	PostID      int64  `json:"post_id"`
+	CommentID   int64  `json:"comment_id"`
+	// Detail carries what the kind needs beyond the IDs, such as the
+	// reaction left.
+	Detail    string    `json:"detail"`
+	ReadAt    time.Time `json:"read_at"`
+	CreatedAt time.Time `json:"created_at"`
+
+	ActorName  string `json:"actor_name,omitempty"`
+	ActorImage string `json:"actor_image,omitempty"`
+	PostTitle  string `json:"post_title,omitempty"`
+	PostSlug   string `json:"post_slug,omitempty"`
+}
+
+func (n *Notification) IsRead() bool {
+	return !n.ReadAt.IsZero()
+}
+
+// NotificationPreferences says which kinds of notification a user wants.
+// Everything is on until the user turns it off.
+type NotificationPreferences struct {
+	Comments  bool `json:"comments"`
+	Replies   bool `json:"replies"`
+	Reactions bool `json:"reactions"`
+	Follows   bool `json:"follows"`
+}
+
+func DefaultNotificationPreferences() NotificationPreferences {
+	return NotificationPreferences{Comments: true, Replies: true, Reactions: true, Follows: true}
+}
+
+func (p NotificationPreferences) Allows(kind string) bool {
+	switch kind {
+	case NotificationComment:
+		return p.Comments
+	case NotificationReply:
+		return p.Replies
+	case NotificationReaction:
+		return p.Reactions
+	case NotificationFollow:
+		return p.Follows
+	}
+	return false
+}
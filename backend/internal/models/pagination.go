@@ -0,0 +1,7 @@
+package models
+
+// Page selects a window of a listing. A zero Limit means no limit.
+type Page struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
@@ -2,6 +2,30 @@ package models
 
 import "time"
 
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+	PostStatusArchived  = "archived"
+)
+
+func IsValidPostStatus(status string) bool {
+	switch status {
+	case PostStatusDraft, PostStatusScheduled, PostStatusPublished, PostStatusArchived:
+		return true
+	}
+	return false
+}
+
+const (
+	PostFormatPlain    = "plain"
+	PostFormatMarkdown = "markdown"
+)
+
+func IsValidPostFormat(format string) bool {
+	return format == PostFormatPlain || format == PostFormatMarkdown
+}
+
 type Post struct {
 	ID        int64     `json:"id"`
 	UserID    int64     `json:"user_id"`
@@ -9,19 +33,68 @@ type Post struct {
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Status    string    `json:"status"`
+	// PublishAt is when a scheduled post goes live, or when a published post
+	// went live. It is zero for drafts.
+	PublishAt time.Time `json:"publish_at"`
+	// Version starts at 1 and is bumped by every update.
+	Version int `json:"version"`
+	// DeletedAt is set while the post is in the trash.
+	DeletedAt time.Time `json:"deleted_at"`
+	// Format says how Content is written, plain or markdown.
+	Format string `json:"format"`
+	// Slug is the readable URL segment derived from the title.
+	Slug string `json:"slug"`
 
 	AuthorName  string `json:"author_name,omitempty"`
 	AuthorEmail string `json:"author_email,omitempty"`
 	AuthorImage string `json:"author_image,omitempty"`
+
+	Tags            []string       `json:"tags"`
+	CommentCount    int            `json:"comment_count"`
+	ReactionCounts  map[string]int `json:"reactions"`
+	ViewerReactions []string       `json:"my_reactions,omitempty"`
+	// ViewerBookmarked is set when the requesting user has saved the post.
+	ViewerBookmarked bool `json:"bookmarked,omitempty"`
+}
+
+// Popularity is the number of reactions of any kind on the post.
+func (p *Post) Popularity() int {
+	total := 0
+	for _, count := range p.ReactionCounts {
+		total += count
+	}
+	return total
 }
 
 type CreatePostParams struct {
-	UserID  int64
-	Title   string
-	Content string
+	UserID    int64
+	Title     string
+	Content   string
+	Status    string
+	PublishAt time.Time
+	Format    string
 }
 
 type UpdatePostParams struct {
-	Title   string
-	Content string
+	Title     string
+	Content   string
+	Status    string
+	PublishAt time.Time
+	Format    string
+}
+
+// PostPatch is a partial update. Nil fields are left unchanged; a PublishAt
+// pointing at the zero time clears it.
+type PostPatch struct {
+	Title     *string
+	Content   *string
+	Status    *string
+	PublishAt *time.Time
+	Format    *string
+}
+
+// IsEmpty reports whether the patch changes nothing.
+func (p PostPatch) IsEmpty() bool {
+	return p.Title == nil && p.Content == nil && p.Status == nil && p.PublishAt == nil && p.Format == nil
 }
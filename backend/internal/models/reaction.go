@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+const (
+	ReactionLike  = "like"
+	ReactionLove  = "love"
+	ReactionLaugh = "laugh"
+	ReactionWow   = "wow"
+	ReactionSad   = "sad"
+)
+
+var ReactionKinds = []string{ReactionLike, ReactionLove, ReactionLaugh, ReactionWow, ReactionSad}
+
+func IsValidReactionKind(kind string) bool {
+	for _, k := range ReactionKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+type Reaction struct {
+	ID        int64     `json:"id"`
+	PostID    int64     `json:"post_id"`
+	UserID    int64     `json:"user_id"`
+	Kind      string    `json:"kind"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type PostRevision struct {
+	ID        int64     `json:"id"`
+	PostID    int64     `json:"post_id"`
+	Rev       int       `json:"rev"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// PostFilter narrows post listings. A post matches Tags only if it carries
+// every tag in the list. An empty Status matches every status.
+type PostFilter struct {
+	Tags   []string
+	Status string
+}
@@ -10,6 +10,17 @@ type User struct {
 	Image     string    `json:"image"`
 	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
+
+	FailedLogins int       `json:"-"`
+	LockedUntil  time.Time `json:"-"`
+	TOTPSecret   string    `json:"-"`
+	TOTPEnabled  bool      `json:"-"`
+	// TOTPLastStep is the latest TOTP time step at which the user passed the
+	// second factor. Codes from it or earlier steps are not accepted again.
+	TOTPLastStep int64 `json:"-"`
+	// SessionVersion is copied into session tokens, which are only accepted
+	// while it is unchanged.
+	SessionVersion int64 `json:"-"`
 }
 
 type CreateUserParams struct {
@@ -18,3 +29,9 @@ type CreateUserParams struct {
 	Name     string
 	Image    string
 }
+
+type UpdateUserParams struct {
+	Email string
+	Name  string
+	Image string
+}
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+const (
+	WebhookPostCreated = "post.created"
+	WebhookPostUpdated = "post.updated"
+	WebhookPostDeleted = "post.deleted"
+	WebhookUserCreated = "user.created"
+	WebhookUserDeleted = "user.deleted"
+)
+
+var WebhookEventTypes = []string{
+	WebhookPostCreated, WebhookPostUpdated, WebhookPostDeleted,
+	WebhookUserCreated, WebhookUserDeleted,
+}
+
+func IsValidWebhookEventType(eventType string) bool {
+	for _, t := range WebhookEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	// DeliveryDead marks a delivery that failed every attempt. Dead
+	// deliveries form the dead-letter list and are only retried by hand.
+	DeliveryDead = "dead"
+)
+
+type Webhook struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedBy int64     `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (w *Webhook) Wants(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// OutboxEvent is an event waiting to be fanned out to the webhooks that
+// subscribe to its type. Payload is the JSON body sent to them.
+type OutboxEvent struct {
+	ID           int64
+	Type         string
+	Payload      string
+	CreatedAt    time.Time
+	DispatchedAt time.Time
+}
+
+type WebhookDelivery struct {
+	ID            int64     `json:"id"`
+	WebhookID     int64     `json:"webhook_id"`
+	EventID       int64     `json:"event_id"`
+	EventType     string    `json:"event_type"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	ResponseCode  int       `json:"response_code"`
+	LastError     string    `json:"last_error"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
@@ -0,0 +1,107 @@
+// Package notify turns activity on posts and profiles into in-app
+// notifications for the users it concerns. Handlers report what happened;
+// the service decides who hears about it, honouring each recipient's
+// preferences.
+package notify
+
+import (
+	"backend/internal/models"
+	"log"
+)
+
+// Store is the storage the service needs. It is satisfied by
+// repository.NotificationRepository.
+type Store interface {
+	GetPreferences(userID int64) (models.NotificationPreferences, error)
+	HasNotification(n *models.Notification) (bool, error)
+	CreateNotification(n *models.Notification) error
+}
+
+// Service creates notifications. A notification that cannot be stored is
+// logged and dropped: the action that caused it has already succeeded.
+type Service struct {
+	store Store
+}
+
+func New(store Store) *Service {
+	return &Service{store: store}
+}
+
+// CommentCreated notifies the post's author of a new comment, and the
+// author of the parent comment when it is a reply. Someone who is both only
+// hears about it once, as a reply.
+func (s *Service) CommentCreated(post *models.Post, comment *models.Comment, parent *models.Comment) {
+	if parent != nil {
+		s.send(&models.Notification{
+			RecipientID: parent.UserID,
+			ActorID:     comment.UserID,
+			Kind:        models.NotificationReply,
+			PostID:      post.ID,
+			CommentID:   comment.ID,
+		}, false)
+		if parent.UserID == post.UserID {
+			return
+		}
+	}
+
+	s.send(&models.Notification{
+		RecipientID: post.UserID,
+		ActorID:     comment.UserID,
+		Kind:        models.NotificationComment,
+		PostID:      post.ID,
+		CommentID:   comment.ID,
+	}, false)
+}
+
+// ReactionAdded notifies the post's author of a reaction. Taking a reaction
+// back and leaving it again does not notify a second time.
+func (s *Service) ReactionAdded(post *models.Post, actorID int64, kind string) {
+	s.send(&models.Notification{
+		RecipientID: post.UserID,
+		ActorID:     actorID,
+		Kind:        models.NotificationReaction,
+		PostID:      post.ID,
+		Detail:      kind,
+	}, true)
+}
+
+// Followed notifies a user of a new follower, once per follower.
+func (s *Service) Followed(actorID, followeeID int64) {
+	s.send(&models.Notification{
+		RecipientID: followeeID,
+		ActorID:     actorID,
+		Kind:        models.NotificationFollow,
+	}, true)
+}
+
+// send stores n unless it is about the recipient's own action, the
+// recipient turned its kind off, or once is set and n was sent before.
+func (s *Service) send(n *models.Notification, once bool) {
+	if n.RecipientID == n.ActorID {
+		return
+	}
+
+	prefs, err := s.store.GetPreferences(n.RecipientID)
+	if err != nil {
+		log.Printf("Failed to load notification preferences of user %d: %v", n.RecipientID, err)
+		return
+	}
+	if !prefs.Allows(n.Kind) {
+		return
+	}
+
+	if once {
+		sent, err := s.store.HasNotification(n)
+		if err != nil {
+			log.Printf("Failed to check %s notification for user %d: %v", n.Kind, n.RecipientID, err)
+			return
+		}
+		if sent {
+			return
+		}
+	}
+
+	if err := s.store.CreateNotification(n); err != nil {
+		log.Printf("Failed to create %s notification for user %d: %v", n.Kind, n.RecipientID, err)
+	}
+}
@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"backend/internal/models"
+	"testing"
+)
+
+type memoryStore struct {
+	prefs map[int64]models.NotificationPreferences
+	sent  []models.Notification
+}
+
+func (m *memoryStore) GetPreferences(userID int64) (models.NotificationPreferences, error) {
+	if prefs, ok := m.prefs[userID]; ok {
+		return prefs, nil
+	}
+	return models.DefaultNotificationPreferences(), nil
+}
+
+func (m *memoryStore) HasNotification(n *models.Notification) (bool, error) {
+	for _, s := range m.sent {
+		if s.RecipientID == n.RecipientID && s.ActorID == n.ActorID && s.Kind == n.Kind &&
+			s.PostID == n.PostID && s.Detail == n.Detail {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryStore) CreateNotification(n *models.Notification) error {
+	m.sent = append(m.sent, *n)
+	return nil
+}
+
+const (
+	author    = 1
+	commenter = 2
+	replier   = 3
+)
+
+func TestCommentCreated(t *testing.T) {
+	post := &models.Post{ID: 10, UserID: author}
+
+	tests := []struct {
+		name    string
+		comment *models.Comment
+		parent  *models.Comment
+		want    map[int64]string // recipient -> kind
+	}{
+		{
+			name:    "top-level comment",
+			comment: &models.Comment{ID: 100, UserID: commenter},
+			want:    map[int64]string{author: models.NotificationComment},
+		},
+		{
+			name:    "reply to another commenter",
+			comment: &models.Comment{ID: 101, UserID: replier},
+			parent:  &models.Comment{ID: 100, UserID: commenter},
+			want:    map[int64]string{commenter: models.NotificationReply, author: models.NotificationComment},
+		},
+		{
+			name:    "reply to the author",
+			comment: &models.Comment{ID: 102, UserID: commenter},
+			parent:  &models.Comment{ID: 99, UserID: author},
+			want:    map[int64]string{author: models.NotificationReply},
+		},
+		{
+			name:    "author comments on their own post",
+			comment: &models.Comment{ID: 103, UserID: author},
+			want:    map[int64]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryStore{}
+			New(store).CommentCreated(post, tt.comment, tt.parent)
+
+			got := make(map[int64]string)
+			for _, n := range store.sent {
+				if _, dup := got[n.RecipientID]; dup {
+					t.Errorf("user %d notified twice", n.RecipientID)
+				}
+				got[n.RecipientID] = n.Kind
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("notified %v, want %v", got, tt.want)
+			}
+			for recipient, kind := range tt.want {
+				if got[recipient] != kind {
+					t.Errorf("user %d got %q, want %q", recipient, got[recipient], kind)
+				}
+			}
+		})
+	}
+}
+
+func TestReactionAddedNotifiesOnce(t *testing.T) {
+	store := &memoryStore{}
+	s := New(store)
+	post := &models.Post{ID: 10, UserID: author}
+
+	s.ReactionAdded(post, commenter, models.ReactionLike)
+	s.ReactionAdded(post, commenter, models.ReactionLike)
+	s.ReactionAdded(post, commenter, models.ReactionLove)
+
+	if len(store.sent) != 2 {
+		t.Fatalf("sent %d notifications, want one per reaction kind", len(store.sent))
+	}
+}
+
+func TestPreferencesAreHonoured(t *testing.T) {
+	prefs := models.DefaultNotificationPreferences()
+	prefs.Follows = false
+	store := &memoryStore{prefs: map[int64]models.NotificationPreferences{author: prefs}}
+	s := New(store)
+
+	s.Followed(commenter, author)
+	if len(store.sent) != 0 {
+		t.Fatalf("follow notification sent although follows are turned off")
+	}
+
+	s.Followed(author, commenter)
+	if len(store.sent) != 1 || store.sent[0].RecipientID != commenter {
+		t.Fatalf("sent %+v, want one follow notification to user %d", store.sent, commenter)
+	}
+}
@@ -0,0 +1,94 @@
+// Package pubsub fans events out to subscribers inside the API process.
+package pubsub
+
+import "sync"
+
+// Hub delivers every published event to every current subscriber. Publish
+// never blocks: a subscriber whose buffer is full has fallen behind, and it
+// is dropped rather than allowed to hold up publishers or the other
+// subscribers. Its channel is closed so the reader can notice and start
+// over.
+type Hub[T any] struct {
+	mu     sync.Mutex
+	subs   map[*Subscription[T]]struct{}
+	closed bool
+}
+
+// Subscription receives events on C until it is closed, by Close, by the
+// hub dropping it or by the hub shutting down.
+type Subscription[T any] struct {
+	C <-chan T
+
+	ch  chan T
+	hub *Hub[T]
+}
+
+func New[T any]() *Hub[T] {
+	return &Hub[T]{subs: make(map[*Subscription[T]]struct{})}
+}
+
+// Subscribe starts a subscription holding up to buffer undelivered events.
+// Subscribing to a closed hub returns a subscription that is already closed.
+func (h *Hub[T]) Subscribe(buffer int) *Subscription[T] {
+	ch := make(chan T, buffer)
+	sub := &Subscription[T]{C: ch, ch: ch, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(ch)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+func (h *Hub[T]) Publish(event T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// Len returns the number of current subscribers.
+func (h *Hub[T]) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.subs)
+}
+
+// Close ends every subscription. Later subscriptions end immediately and
+// later events are discarded.
+func (h *Hub[T]) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		h.remove(sub)
+	}
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription[T]) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, ok := s.hub.subs[s]; ok {
+		s.hub.remove(s)
+	}
+}
+
+// remove must be called with h.mu held.
+func (h *Hub[T]) remove(sub *Subscription[T]) {
+	delete(h.subs, sub)
+	close(sub.ch)
+}
@@ -0,0 +1,80 @@
+package pubsub
+
+import "testing"
+
+func TestPublishReachesEverySubscriber(t *testing.T) {
+	h := New[int]()
+	a := h.Subscribe(4)
+	b := h.Subscribe(4)
+
+	h.Publish(1)
+	h.Publish(2)
+
+	for name, sub := range map[string]*Subscription[int]{"a": a, "b": b} {
+		for _, want := range []int{1, 2} {
+			if got := <-sub.C; got != want {
+				t.Errorf("subscriber %s got %d, want %d", name, got, want)
+			}
+		}
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	h := New[int]()
+	slow := h.Subscribe(1)
+	fast := h.Subscribe(4)
+
+	h.Publish(1)
+	h.Publish(2) // slow's buffer is full
+
+	if h.Len() != 1 {
+		t.Fatalf("Len() = %d, want the slow subscriber gone", h.Len())
+	}
+
+	if got := <-slow.C; got != 1 {
+		t.Errorf("slow got %d, want the event buffered before it fell behind", got)
+	}
+	if _, ok := <-slow.C; ok {
+		t.Error("slow subscriber's channel was not closed")
+	}
+
+	for _, want := range []int{1, 2} {
+		if got := <-fast.C; got != want {
+			t.Errorf("fast got %d, want %d", got, want)
+		}
+	}
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	h := New[int]()
+	sub := h.Subscribe(1)
+
+	h.Close()
+	h.Publish(1)
+
+	if _, ok := <-sub.C; ok {
+		t.Error("subscription still open after the hub closed")
+	}
+	if _, ok := <-h.Subscribe(1).C; ok {
+		t.Error("subscribing to a closed hub returned an open subscription")
+	}
+
+	// Closing a subscription the hub already ended must not panic.
+	sub.Close()
+}
+
+func TestUnsubscribe(t *testing.T) {
+	h := New[int]()
+	sub := h.Subscribe(1)
+
+	sub.Close()
+	sub.Close()
+	h.Publish(1)
+
+	if h.Len() != 0 {
+		t.Fatalf("Len() = %d after unsubscribing", h.Len())
+	}
+	if _, ok := <-sub.C; ok {
+		t.Error("channel still open after Close")
+	}
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// memoryBucket remembers the refill period of the limit it was last taken
+// from, since limits of different periods share the store.
+type memoryBucket struct {
+	bucket
+	per time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*memoryBucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{}
+		s.buckets[key] = b
+	}
+	b.per = limit.Per
+
+	return take(&b.bucket, limit, now), nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again, so
+// one-off clients don't accumulate in memory forever.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.Sub(b.updatedAt) > b.per {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"backend/internal/database"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NimbleStore keeps buckets in NimbleDB so that several API instances share
+// the same counters. NimbleDB has no transactions, so concurrent requests for
+// the same key on different instances may occasionally both be admitted.
+type NimbleStore struct {
+	db database.Service
+	mu sync.Mutex
+}
+
+func NewNimbleStore(db database.Service) *NimbleStore {
+	return &NimbleStore{db: db}
+}
+
+func (s *NimbleStore) InitTable() error {
+	query := "CREATE TABLE rate_limits (bucket_key VARCHAR(64) NOT NULL, tokens FLOAT, updated_at INT, PRIMARY KEY (bucket_key))"
+
+	err := s.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *NimbleStore) Take(key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(key))
+	bucketKey := hex.EncodeToString(sum[:])
+
+	query := fmt.Sprintf("SELECT tokens, updated_at FROM rate_limits WHERE bucket_key = '%s'", bucketKey)
+	_, rows, err := s.db.Query(query)
+	if err != nil {
+		return Result{}, err
+	}
+
+	b := &bucket{}
+	exists := len(rows) > 0 && len(rows[0]) >= 2
+	if exists {
+		b.tokens, _ = rows[0][0].(float64)
+		if updatedAt, ok := rows[0][1].(int64); ok {
+			b.updatedAt = time.UnixMilli(updatedAt)
+		}
+	}
+
+	now := time.Now()
+	result := take(b, limit, now)
+
+	if exists {
+		query = fmt.Sprintf(
+			"UPDATE rate_limits SET tokens = %f, updated_at = %d WHERE bucket_key = '%s'",
+			b.tokens, now.UnixMilli(), bucketKey,
+		)
+	} else {
+		query = fmt.Sprintf(
+			"INSERT INTO rate_limits VALUES ('%s', %f, %d)",
+			bucketKey, b.tokens, now.UnixMilli(),
+		)
+	}
+
+	if err := s.db.Execute(query); err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
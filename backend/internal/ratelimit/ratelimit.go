@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// Limit describes a token bucket that holds at most Burst tokens and refills
+// completely over Per.
+type Limit struct {
+	Burst int
+	Per   time.Duration
+}
+
+func (l Limit) Enabled() bool {
+	return l.Burst > 0 && l.Per > 0
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Per.Seconds()
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type Store interface {
+	Take(key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+func take(b *bucket, limit Limit, now time.Time) Result {
+	if b.updatedAt.IsZero() {
+		b.tokens = float64(limit.Burst)
+	} else if elapsed := now.Sub(b.updatedAt).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.rate())
+	}
+	b.updatedAt = now
+
+	result := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / limit.rate())
+	}
+
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = secondsToDuration((float64(limit.Burst) - b.tokens) / limit.rate())
+	return result
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
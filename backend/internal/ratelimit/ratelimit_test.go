@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	limit := Limit{Burst: 3, Per: 3 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Take("ip:1.2.3.4", limit)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("request %d: expected to be allowed", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("request %d: expected remaining %d; got %d", i+1, 2-i, result.Remaining)
+		}
+	}
+
+	result, _ := store.Take("ip:1.2.3.4", limit)
+	if result.Allowed {
+		t.Fatal("expected request over the burst to be rejected")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("expected retry after 1s; got %v", result.RetryAfter)
+	}
+
+	other, _ := store.Take("ip:5.6.7.8", limit)
+	if !other.Allowed {
+		t.Error("expected a different key to have its own bucket")
+	}
+
+	now = now.Add(time.Second)
+	result, _ = store.Take("ip:1.2.3.4", limit)
+	if !result.Allowed {
+		t.Error("expected a token to be refilled after one second")
+	}
+}
+
+func TestMemoryStoreSweepUsesEachBucketsPeriod(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	hourly := Limit{Burst: 1, Per: time.Hour}
+	store.Take("account:1", hourly)
+
+	// A take under a short limit sweeps, but the hourly bucket is not full
+	// again yet and must survive it.
+	now = now.Add(2 * time.Minute)
+	store.Take("ip:1.2.3.4", Limit{Burst: 10, Per: time.Minute})
+
+	if result, _ := store.Take("account:1", hourly); result.Allowed {
+		t.Error("hourly bucket was swept before it refilled")
+	}
+
+	now = now.Add(2 * time.Hour)
+	store.Take("ip:1.2.3.4", Limit{Burst: 10, Per: time.Minute})
+	if _, ok := store.buckets["account:1"]; ok {
+		t.Error("idle bucket was not swept once full again")
+	}
+}
@@ -0,0 +1,129 @@
+// Package render turns post content into HTML that is safe to embed in a
+// page. Markdown is converted with goldmark and the result is passed through
+// an allowlist sanitizer, so raw HTML, scripts and javascript: links in the
+// source never reach the reader.
+package render
+
+import (
+	"backend/internal/models"
+	"bytes"
+	"container/list"
+	"html"
+	"strings"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Renderer renders content and caches rendered posts. Posts are keyed by ID
+// and version: every edit bumps the version, so a cached entry never goes
+// stale, it just stops being asked for and ages out.
+type Renderer struct {
+	markdown goldmark.Markdown
+	policy   *bluemonday.Policy
+
+	mu       sync.Mutex
+	capacity int
+	entries  map[cacheKey]*list.Element
+	order    *list.List // most recently used at the front
+}
+
+type cacheKey struct {
+	postID  int64
+	version int
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	html string
+}
+
+// New returns a Renderer that keeps up to capacity rendered posts.
+func New(capacity int) *Renderer {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	policy := bluemonday.UGCPolicy()
+	policy.AddTargetBlankToFullyQualifiedLinks(true)
+
+	return &Renderer{
+		markdown: goldmark.New(
+			goldmark.WithExtensions(extension.Table, extension.Strikethrough, extension.Linkify),
+		),
+		policy:   policy,
+		capacity: capacity,
+		entries:  make(map[cacheKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Render converts source written in format to sanitized HTML. Unknown formats
+// are treated as plain text.
+func (r *Renderer) Render(format, source string) (string, error) {
+	if format != models.PostFormatMarkdown {
+		return plainHTML(source), nil
+	}
+
+	var buf bytes.Buffer
+	if err := r.markdown.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return r.policy.Sanitize(buf.String()), nil
+}
+
+// Post returns the rendered content of post, from the cache when this
+// version has been rendered before. Markdown that fails to convert is shown
+// as plain text rather than failing the request.
+func (r *Renderer) Post(post *models.Post) string {
+	key := cacheKey{postID: post.ID, version: post.Version}
+
+	r.mu.Lock()
+	if elem, ok := r.entries[key]; ok {
+		r.order.MoveToFront(elem)
+		r.mu.Unlock()
+		return elem.Value.(*cacheEntry).html
+	}
+	r.mu.Unlock()
+
+	rendered, err := r.Render(post.Format, post.Content)
+	if err != nil {
+		rendered = plainHTML(post.Content)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[key]; !ok {
+		r.entries[key] = r.order.PushFront(&cacheEntry{key: key, html: rendered})
+		for r.order.Len() > r.capacity {
+			oldest := r.order.Back()
+			r.order.Remove(oldest)
+			delete(r.entries, oldest.Value.(*cacheEntry).key)
+		}
+	}
+	return rendered
+}
+
+// plainHTML escapes text and keeps its layout: blank lines separate
+// paragraphs and single newlines become line breaks.
+func plainHTML(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var b strings.Builder
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.Trim(paragraph, "\n")
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		lines := strings.Split(paragraph, "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(line)
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.Join(lines, "<br>\n"))
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
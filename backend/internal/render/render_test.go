@@ -0,0 +1,116 @@
+package render
+
+import (
+	"backend/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	r := New(10)
+
+	got, err := r.Render(models.PostFormatMarkdown, "# Title\n\nSome *emphasis* and `code`.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<h1>Title</h1>", "<em>emphasis</em>", "<code>code</code>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Render() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	r := New(10)
+
+	tests := []struct {
+		name   string
+		source string
+		banned string
+	}{
+		{"script tag", "hi <script>alert(1)</script>", "<script"},
+		{"event handler", `<img src="x.png" onerror="alert(1)">`, "onerror"},
+		{"javascript link", "[click](javascript:alert(1))", "javascript:"},
+		{"iframe", `<iframe src="https://evil.example"></iframe>`, "<iframe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Render(models.PostFormatMarkdown, tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(strings.ToLower(got), tt.banned) {
+				t.Errorf("Render(%q) = %q, contains %q", tt.source, got, tt.banned)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownLinks(t *testing.T) {
+	r := New(10)
+
+	got, err := r.Render(models.PostFormatMarkdown, "[docs](https://example.com/docs)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`href="https://example.com/docs"`, `rel="nofollow noopener"`, `target="_blank"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Render() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestRenderPlain(t *testing.T) {
+	r := New(10)
+
+	got, err := r.Render(models.PostFormatPlain, "a <b> & *c*\nnext line\n\nsecond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "<p>a &lt;b&gt; &amp; *c*<br>\nnext line</p>\n<p>second</p>\n"
+	if got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
+
+func TestPostCachesByVersion(t *testing.T) {
+	r := New(10)
+	post := &models.Post{ID: 1, Version: 1, Format: models.PostFormatMarkdown, Content: "**v1**"}
+
+	first := r.Post(post)
+	if !strings.Contains(first, "<strong>v1</strong>") {
+		t.Fatalf("Post() = %q", first)
+	}
+
+	// Same version: the cached HTML is served even though the text differs.
+	post.Content = "**changed**"
+	if got := r.Post(post); got != first {
+		t.Errorf("Post() at the same version = %q, want cached %q", got, first)
+	}
+
+	post.Version = 2
+	if got := r.Post(post); !strings.Contains(got, "<strong>changed</strong>") {
+		t.Errorf("Post() at a new version = %q, want re-rendered content", got)
+	}
+}
+
+func TestPostEvictsLeastRecentlyUsed(t *testing.T) {
+	r := New(2)
+	a := &models.Post{ID: 1, Version: 1, Content: "a"}
+	b := &models.Post{ID: 2, Version: 1, Content: "b"}
+	c := &models.Post{ID: 3, Version: 1, Content: "c"}
+
+	r.Post(a)
+	r.Post(b)
+	r.Post(a) // a is now the most recently used
+	r.Post(c) // evicts b
+
+	if _, ok := r.entries[cacheKey{postID: 2, version: 1}]; ok {
+		t.Error("least recently used entry was not evicted")
+	}
+	for _, id := range []int64{1, 3} {
+		if _, ok := r.entries[cacheKey{postID: id, version: 1}]; !ok {
+			t.Errorf("post %d missing from cache", id)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type AccessTokenRepository struct {
+	db database.Service
+}
+
+func NewAccessTokenRepository(db database.Service) *AccessTokenRepository {
+	return &AccessTokenRepository{db: db}
+}
+
+func (r *AccessTokenRepository) InitTable() error {
+	query := "CREATE TABLE access_tokens (id INT NOT NULL, user_id INT NOT NULL, name VARCHAR(100), token_hash VARCHAR(64), scopes VARCHAR(255), expires_at INT, last_used_at INT, created_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *AccessTokenRepository) CreateToken(params models.CreateAccessTokenParams) (*models.AccessToken, error) {
+	id := nextID()
+	now := time.Now().Unix()
+
+	query := fmt.Sprintf(
+		"INSERT INTO access_tokens VALUES (%d, %d, '%s', '%s', '%s', %d, 0, %d)",
+		id, params.UserID, escapeString(params.Name), escapeString(params.TokenHash),
+		escapeString(strings.Join(params.Scopes, " ")), params.ExpiresAt.Unix(), now,
+	)
+
+	err := r.db.Execute(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AccessToken{
+		ID:        id,
+		UserID:    params.UserID,
+		Name:      params.Name,
+		TokenHash: params.TokenHash,
+		Scopes:    params.Scopes,
+		ExpiresAt: time.Unix(params.ExpiresAt.Unix(), 0),
+		CreatedAt: time.Unix(now, 0),
+	}, nil
+}
+
+func (r *AccessTokenRepository) GetTokensByUserID(userID int64) ([]models.AccessToken, error) {
+	query := fmt.Sprintf("SELECT %s FROM access_tokens WHERE user_id = %d ORDER BY created_at DESC", accessTokenColumns, userID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]models.AccessToken, 0, len(rows))
+	for _, row := range rows {
+		token, err := scanAccessToken(row)
+		if err != nil {
+			continue
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, nil
+}
+
+func (r *AccessTokenRepository) GetTokenByHash(tokenHash string) (*models.AccessToken, error) {
+	query := fmt.Sprintf("SELECT %s FROM access_tokens WHERE token_hash = '%s'", accessTokenColumns, escapeString(tokenHash))
+
+	row, err := r.db.QueryRow(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAccessToken(row)
+}
+
+func (r *AccessTokenRepository) TouchToken(id int64) error {
+	query := fmt.Sprintf("UPDATE access_tokens SET last_used_at = %d WHERE id = %d", time.Now().Unix(), id)
+	return r.db.Execute(query)
+}
+
+func (r *AccessTokenRepository) CheckTokenOwnership(tokenID, userID int64) (bool, error) {
+	query := fmt.Sprintf("SELECT user_id FROM access_tokens WHERE id = %d", tokenID)
+
+	row, err := r.db.QueryRow(query)
+	if err != nil {
+		return false, err
+	}
+
+	if len(row) < 1 {
+		return false, fmt.Errorf("token not found")
+	}
+
+	ownerID := row[0].(int64)
+	return ownerID == userID, nil
+}
+
+func (r *AccessTokenRepository) DeleteToken(id int64) error {
+	query := fmt.Sprintf("DELETE FROM access_tokens WHERE id = %d", id)
+	return r.db.Execute(query)
+}
+
+func (r *AccessTokenRepository) DeleteTokensByUserID(userID int64) error {
+	query := fmt.Sprintf("DELETE FROM access_tokens WHERE user_id = %d", userID)
+	return r.db.Execute(query)
+}
+
+const accessTokenColumns = "id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at"
+
+func scanAccessToken(row []interface{}) (*models.AccessToken, error) {
+	if len(row) < 8 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	token := &models.AccessToken{
+		ID:        row[0].(int64),
+		UserID:    row[1].(int64),
+		Name:      row[2].(string),
+		TokenHash: row[3].(string),
+		Scopes:    strings.Fields(row[4].(string)),
+		ExpiresAt: time.Unix(row[5].(int64), 0),
+		CreatedAt: time.Unix(row[7].(int64), 0),
+	}
+
+	if lastUsed := row[6].(int64); lastUsed > 0 {
+		lastUsedAt := time.Unix(lastUsed, 0)
+		token.LastUsedAt = &lastUsedAt
+	}
+
+	return token, nil
+}
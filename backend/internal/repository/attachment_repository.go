@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// AttachmentRepository records uploaded files. The files themselves live in
+// a blob store; rows here only point at them.
+type AttachmentRepository struct {
+	db database.Service
+}
+
+func NewAttachmentRepository(db database.Service) *AttachmentRepository {
+	return &AttachmentRepository{db: db}
+}
+
+func (r *AttachmentRepository) InitTable() error {
+	query := "CREATE TABLE attachments (id INT NOT NULL, post_id INT NOT NULL, user_id INT NOT NULL, filename VARCHAR(255), content_type VARCHAR(100), size INT, width INT, height INT, storage_key VARCHAR(255), thumbnail_key VARCHAR(255), created_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *AttachmentRepository) CreateAttachment(params models.CreateAttachmentParams) (*models.Attachment, error) {
+	id := nextID()
+	now := time.Now().Unix()
+
+	query := fmt.Sprintf(
+		"INSERT INTO attachments VALUES (%d, %d, %d, '%s', '%s', %d, %d, %d, '%s', '%s', %d)",
+		id, params.PostID, params.UserID, escapeString(params.Filename), escapeString(params.ContentType),
+		params.Size, params.Width, params.Height, escapeString(params.StorageKey), escapeString(params.ThumbnailKey), now,
+	)
+
+	if err := r.db.Execute(query); err != nil {
+		return nil, err
+	}
+
+	return &models.Attachment{
+		ID:           id,
+		PostID:       params.PostID,
+		UserID:       params.UserID,
+		Filename:     params.Filename,
+		ContentType:  params.ContentType,
+		Size:         params.Size,
+		Width:        params.Width,
+		Height:       params.Height,
+		CreatedAt:    time.Unix(now, 0),
+		StorageKey:   params.StorageKey,
+		ThumbnailKey: params.ThumbnailKey,
+	}, nil
+}
+
+func (r *AttachmentRepository) GetAttachmentByID(id int64) (*models.Attachment, error) {
+	query := fmt.Sprintf("SELECT %s FROM attachments WHERE id = %d", attachmentColumns, id)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrAttachmentNotFound
+	}
+
+	return scanAttachment(rows[0])
+}
+
+// GetAttachmentsByPostID returns a post's attachments in upload order.
+func (r *AttachmentRepository) GetAttachmentsByPostID(postID int64) ([]models.Attachment, error) {
+	return r.query(fmt.Sprintf("SELECT %s FROM attachments WHERE post_id = %d ORDER BY id ASC", attachmentColumns, postID))
+}
+
+// GetUserFiles returns the attachments a user owns that are not part of a
+// post, such as their avatar.
+func (r *AttachmentRepository) GetUserFiles(userID int64) ([]models.Attachment, error) {
+	return r.query(fmt.Sprintf("SELECT %s FROM attachments WHERE user_id = %d AND post_id = 0", attachmentColumns, userID))
+}
+
+// GetOrphanedAttachments returns attachments created before cutoff whose
+// post has been purged, or whose owner has been deleted for files not tied
+// to a post. NimbleDB has no outer joins, so the live IDs are fetched and
+// compared here. They are read after the attachments, so an upload to a
+// post created in between is not taken for an orphan, and the cutoff leaves
+// alone uploads that are still being saved.
+func (r *AttachmentRepository) GetOrphanedAttachments(cutoff time.Time) ([]models.Attachment, error) {
+	attachments, err := r.query(fmt.Sprintf("SELECT %s FROM attachments WHERE created_at < %d", attachmentColumns, cutoff.Unix()))
+	if err != nil {
+		return nil, err
+	}
+
+	livePosts, err := r.ids("SELECT id FROM posts")
+	if err != nil {
+		return nil, err
+	}
+	liveUsers, err := r.ids("SELECT id FROM users")
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []models.Attachment
+	for _, a := range attachments {
+		if a.PostID != 0 && !livePosts[a.PostID] || a.PostID == 0 && !liveUsers[a.UserID] {
+			orphans = append(orphans, a)
+		}
+	}
+	return orphans, nil
+}
+
+// SetThumbnailKey records where an attachment's thumbnail was stored. It
+// reports false if the attachment no longer exists.
+func (r *AttachmentRepository) SetThumbnailKey(id int64, key string) (bool, error) {
+	query := fmt.Sprintf("UPDATE attachments SET thumbnail_key = '%s' WHERE id = %d", escapeString(key), id)
+	affected, err := r.db.ExecuteAffected(query)
+	return affected > 0, err
+}
+
+func (r *AttachmentRepository) DeleteAttachment(id int64) error {
+	return r.db.Execute(fmt.Sprintf("DELETE FROM attachments WHERE id = %d", id))
+}
+
+func (r *AttachmentRepository) query(query string) ([]models.Attachment, error) {
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments := make([]models.Attachment, 0, len(rows))
+	for _, row := range rows {
+		attachment, err := scanAttachment(row)
+		if err != nil {
+			continue
+		}
+		attachments = append(attachments, *attachment)
+	}
+
+	return attachments, nil
+}
+
+func (r *AttachmentRepository) ids(query string) (map[int64]bool, error) {
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[int64]bool, len(rows))
+	for _, row := range rows {
+		if len(row) > 0 {
+			ids[row[0].(int64)] = true
+		}
+	}
+	return ids, nil
+}
+
+const attachmentColumns = "id, post_id, user_id, filename, content_type, size, width, height, storage_key, thumbnail_key, created_at"
+
+func scanAttachment(row []interface{}) (*models.Attachment, error) {
+	if len(row) < 11 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	return &models.Attachment{
+		ID:           row[0].(int64),
+		PostID:       row[1].(int64),
+		UserID:       row[2].(int64),
+		Filename:     row[3].(string),
+		ContentType:  row[4].(string),
+		Size:         row[5].(int64),
+		Width:        int(row[6].(int64)),
+		Height:       int(row[7].(int64)),
+		StorageKey:   row[8].(string),
+		ThumbnailKey: row[9].(string),
+		CreatedAt:    time.Unix(row[10].(int64), 0),
+	}, nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BookmarkRepository stores one row per (saved_by, post_id), which
+// AddBookmark keeps unique with insertUnique. The user column is not called
+// user_id because NimbleDB resolves duplicate column names in a join to the
+// first table, and bookmarks are joined with posts.
+type BookmarkRepository struct {
+	db database.Service
+}
+
+func NewBookmarkRepository(db database.Service) *BookmarkRepository {
+	return &BookmarkRepository{db: db}
+}
+
+func (r *BookmarkRepository) InitTable() error {
+	query := "CREATE TABLE bookmarks (id INT NOT NULL, saved_by INT NOT NULL, post_id INT NOT NULL, saved_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// AddBookmark saves a post for a user. Saving it again is a no-op.
+func (r *BookmarkRepository) AddBookmark(userID, postID int64) error {
+	exists := fmt.Sprintf("SELECT id FROM bookmarks WHERE saved_by = %d AND post_id = %d", userID, postID)
+	key := fmt.Sprintf("bookmark:%d:%d", userID, postID)
+
+	return insertUnique(r.db, key, exists, func(id int64) string {
+		return fmt.Sprintf(
+			"INSERT INTO bookmarks VALUES (%d, %d, %d, %d)",
+			id, userID, postID, time.Now().Unix(),
+		)
+	})
+}
+
+func (r *BookmarkRepository) RemoveBookmark(userID, postID int64) error {
+	query := fmt.Sprintf("DELETE FROM bookmarks WHERE saved_by = %d AND post_id = %d", userID, postID)
+	return r.db.Execute(query)
+}
+
+// GetBookmarkedPostIDs returns the set of posts a user has saved.
+func (r *BookmarkRepository) GetBookmarkedPostIDs(userID int64) (map[int64]bool, error) {
+	query := fmt.Sprintf("SELECT post_id FROM bookmarks WHERE saved_by = %d", userID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[int64]bool, len(rows))
+	for _, row := range rows {
+		if len(row) > 0 {
+			ids[row[0].(int64)] = true
+		}
+	}
+	return ids, nil
+}
+
+func (r *BookmarkRepository) DeleteByUserID(userID int64) error {
+	query := fmt.Sprintf("DELETE FROM bookmarks WHERE saved_by = %d", userID)
+	return r.db.Execute(query)
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type CommentRepository struct {
+	db database.Service
+}
+
+func NewCommentRepository(db database.Service) *CommentRepository {
+	return &CommentRepository{db: db}
+}
+
+func (r *CommentRepository) InitTable() error {
+	query := "CREATE TABLE comments (id INT NOT NULL, post_id INT NOT NULL, user_id INT NOT NULL, parent_id INT, content VARCHAR(2000), created_at INT, updated_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *CommentRepository) CreateComment(params models.CreateCommentParams) (*models.Comment, error) {
+	id := nextID()
+	now := time.Now().Unix()
+
+	query := fmt.Sprintf(
+		"INSERT INTO comments VALUES (%d, %d, %d, %d, '%s', %d, %d)",
+		id, params.PostID, params.UserID, params.ParentID, escapeString(params.Content), now, now,
+	)
+
+	err := r.db.Execute(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Comment{
+		ID:        id,
+		PostID:    params.PostID,
+		UserID:    params.UserID,
+		ParentID:  params.ParentID,
+		Content:   params.Content,
+		CreatedAt: time.Unix(now, 0),
+		UpdatedAt: time.Unix(now, 0),
+	}, nil
+}
+
+func (r *CommentRepository) GetCommentsByPostID(postID int64) ([]models.Comment, error) {
+	query := fmt.Sprintf("SELECT %s FROM comments WHERE post_id = %d ORDER BY created_at ASC", commentColumns, postID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	comments := make([]models.Comment, 0, len(rows))
+	for _, row := range rows {
+		comment, err := scanComment(row)
+		if err != nil {
+			continue
+		}
+
+		userQuery := fmt.Sprintf("SELECT name, image FROM users WHERE id = %d", comment.UserID)
+		userRow, err := r.db.QueryRow(userQuery)
+		if err == nil && len(userRow) >= 2 {
+			comment.AuthorName = userRow[0].(string)
+			comment.AuthorImage = userRow[1].(string)
+		}
+
+		comments = append(comments, *comment)
+	}
+
+	return comments, nil
+}
+
+func (r *CommentRepository) GetCommentByID(id int64) (*models.Comment, error) {
+	query := fmt.Sprintf("SELECT %s FROM comments WHERE id = %d", commentColumns, id)
+
+	row, err := r.db.QueryRow(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanComment(row)
+}
+
+func (r *CommentRepository) UpdateComment(id int64, content string) error {
+	query := fmt.Sprintf(
+		"UPDATE comments SET content = '%s', updated_at = %d WHERE id = %d",
+		escapeString(content), time.Now().Unix(), id,
+	)
+
+	return r.db.Execute(query)
+}
+
+// DeleteComment removes a comment together with every reply beneath it.
+func (r *CommentRepository) DeleteComment(id int64) error {
+	comment, err := r.GetCommentByID(id)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("SELECT id, parent_id FROM comments WHERE post_id = %d", comment.PostID)
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return err
+	}
+
+	children := make(map[int64][]int64)
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		parentID, _ := row[1].(int64)
+		children[parentID] = append(children[parentID], row[0].(int64))
+	}
+
+	pending := []int64{id}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = append(pending[:len(pending)-1], children[current]...)
+
+		if err := r.db.Execute(fmt.Sprintf("DELETE FROM comments WHERE id = %d", current)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *CommentRepository) DeleteCommentsByUserID(userID int64) error {
+	query := fmt.Sprintf("DELETE FROM comments WHERE user_id = %d", userID)
+	return r.db.Execute(query)
+}
+
+func (r *CommentRepository) CheckCommentOwnership(commentID, userID int64) (bool, error) {
+	query := fmt.Sprintf("SELECT user_id FROM comments WHERE id = %d", commentID)
+
+	row, err := r.db.QueryRow(query)
+	if err != nil {
+		return false, err
+	}
+
+	if len(row) < 1 {
+		return false, fmt.Errorf("comment not found")
+	}
+
+	ownerID := row[0].(int64)
+	return ownerID == userID, nil
+}
+
+const commentColumns = "id, post_id, user_id, parent_id, content, created_at, updated_at"
+
+func scanComment(row []interface{}) (*models.Comment, error) {
+	if len(row) < 7 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	comment := &models.Comment{
+		ID:        row[0].(int64),
+		PostID:    row[1].(int64),
+		UserID:    row[2].(int64),
+		Content:   row[4].(string),
+		CreatedAt: time.Unix(row[5].(int64), 0),
+		UpdatedAt: time.Unix(row[6].(int64), 0),
+	}
+	comment.ParentID, _ = row[3].(int64)
+
+	return comment, nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FollowRepository stores one row per (follower_id, followee_id), which
+// Follow keeps unique with insertUnique.
+type FollowRepository struct {
+	db database.Service
+}
+
+func NewFollowRepository(db database.Service) *FollowRepository {
+	return &FollowRepository{db: db}
+}
+
+func (r *FollowRepository) InitTable() error {
+	query := "CREATE TABLE follows (id INT NOT NULL, follower_id INT NOT NULL, followee_id INT NOT NULL, created_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Follow makes followerID follow followeeID. Following someone twice is a
+// no-op.
+func (r *FollowRepository) Follow(followerID, followeeID int64) error {
+	exists := fmt.Sprintf(
+		"SELECT id FROM follows WHERE follower_id = %d AND followee_id = %d",
+		followerID, followeeID,
+	)
+	key := fmt.Sprintf("follow:%d:%d", followerID, followeeID)
+
+	return insertUnique(r.db, key, exists, func(id int64) string {
+		return fmt.Sprintf(
+			"INSERT INTO follows VALUES (%d, %d, %d, %d)",
+			id, followerID, followeeID, time.Now().Unix(),
+		)
+	})
+}
+
+func (r *FollowRepository) Unfollow(followerID, followeeID int64) error {
+	query := fmt.Sprintf(
+		"DELETE FROM follows WHERE follower_id = %d AND followee_id = %d",
+		followerID, followeeID,
+	)
+	return r.db.Execute(query)
+}
+
+func (r *FollowRepository) IsFollowing(followerID, followeeID int64) (bool, error) {
+	query := fmt.Sprintf(
+		"SELECT id FROM follows WHERE follower_id = %d AND followee_id = %d",
+		followerID, followeeID,
+	)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// GetFollowerIDs returns the users following userID.
+func (r *FollowRepository) GetFollowerIDs(userID int64) ([]int64, error) {
+	return r.ids(fmt.Sprintf("SELECT follower_id FROM follows WHERE followee_id = %d", userID))
+}
+
+// GetFollowingIDs returns the users userID follows.
+func (r *FollowRepository) GetFollowingIDs(userID int64) ([]int64, error) {
+	return r.ids(fmt.Sprintf("SELECT followee_id FROM follows WHERE follower_id = %d", userID))
+}
+
+// DeleteByUserID removes every follow to or from a user.
+func (r *FollowRepository) DeleteByUserID(userID int64) error {
+	query := fmt.Sprintf("DELETE FROM follows WHERE follower_id = %d OR followee_id = %d", userID, userID)
+	return r.db.Execute(query)
+}
+
+func (r *FollowRepository) ids(query string) ([]int64, error) {
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(rows))
+	for _, row := range rows {
+		if len(row) > 0 {
+			ids = append(ids, row[0].(int64))
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	idMu   sync.Mutex
+	lastID int64
+)
+
+// nextID returns a millisecond timestamp like the IDs users and posts get,
+// bumped when needed so that rows inserted within the same millisecond don't
+// collide on their primary key.
+func nextID() int64 {
+	idMu.Lock()
+	defer idMu.Unlock()
+
+	id := time.Now().UnixNano() / 1000000
+	if id <= lastID {
+		id = lastID + 1
+	}
+	lastID = id
+	return id
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JobRepository stores the background job queue. NimbleDB has no row
+// locks, so jobs are claimed with a conditional UPDATE on run_at: each lease
+// goes to exactly one worker across all API instances.
+type JobRepository struct {
+	db database.Service
+}
+
+func NewJobRepository(db database.Service) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+func (r *JobRepository) InitTable() error {
+	query := "CREATE TABLE jobs (id INT NOT NULL, kind VARCHAR(100), payload VARCHAR(2000), status VARCHAR(20), attempts INT, max_attempts INT, run_at INT, last_error VARCHAR(500), created_at INT, updated_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateJob stores job as pending, filling in its ID and timestamps.
+func (r *JobRepository) CreateJob(job *models.Job) error {
+	now := time.Unix(time.Now().Unix(), 0)
+	job.ID = nextID()
+	job.Status = models.JobPending
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	query := fmt.Sprintf(
+		"INSERT INTO jobs VALUES (%d, '%s', '%s', '%s', %d, %d, %d, '%s', %d, %d)",
+		job.ID, escapeString(job.Kind), escapeString(job.Payload), job.Status, job.Attempts, job.MaxAttempts,
+		job.RunAt.Unix(), escapeString(truncateError(job.LastError)), now.Unix(), now.Unix(),
+	)
+	return r.db.Execute(query)
+}
+
+// GetDueJobs returns up to limit pending jobs whose run_at has passed,
+// longest waiting first.
+func (r *JobRepository) GetDueJobs(now time.Time, limit int) ([]models.Job, error) {
+	query := fmt.Sprintf(
+		"SELECT %s FROM jobs WHERE status = '%s' AND run_at <= %d ORDER BY run_at ASC LIMIT %d",
+		jobColumns, models.JobPending, now.Unix(), limit,
+	)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]models.Job, 0, len(rows))
+	for _, row := range rows {
+		job, err := scanJob(row)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, nil
+}
+
+// UpdateJob saves job's status, attempts, run_at and last error, but only
+// if the stored job is still pending with run_at equal to from. It reports
+// whether it was; if not, someone else holds the job and nothing changed.
+func (r *JobRepository) UpdateJob(job *models.Job, from time.Time) (bool, error) {
+	job.UpdatedAt = time.Unix(time.Now().Unix(), 0)
+	query := fmt.Sprintf(
+		"UPDATE jobs SET status = '%s', attempts = %d, run_at = %d, last_error = '%s', updated_at = %d WHERE id = %d AND status = '%s' AND run_at = %d",
+		escapeString(job.Status), job.Attempts, job.RunAt.Unix(), escapeString(truncateError(job.LastError)), job.UpdatedAt.Unix(),
+		job.ID, models.JobPending, from.Unix(),
+	)
+	affected, err := r.db.ExecuteAffected(query)
+	return affected > 0, err
+}
+
+func (r *JobRepository) DeleteJob(id int64) error {
+	return r.db.Execute(fmt.Sprintf("DELETE FROM jobs WHERE id = %d", id))
+}
+
+// maxErrorLength is the width of the last_error columns of jobs and
+// webhook_deliveries.
+const maxErrorLength = 500
+
+// truncateError cuts an error message down to fit a last_error column.
+func truncateError(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
+
+const jobColumns = "id, kind, payload, status, attempts, max_attempts, run_at, last_error, created_at, updated_at"
+
+func scanJob(row []interface{}) (*models.Job, error) {
+	if len(row) < 10 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	return &models.Job{
+		ID:          row[0].(int64),
+		Kind:        row[1].(string),
+		Payload:     row[2].(string),
+		Status:      row[3].(string),
+		Attempts:    int(row[4].(int64)),
+		MaxAttempts: int(row[5].(int64)),
+		RunAt:       time.Unix(row[6].(int64), 0),
+		LastError:   row[7].(string),
+		CreatedAt:   time.Unix(row[8].(int64), 0),
+		UpdatedAt:   time.Unix(row[9].(int64), 0),
+	}, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type LoginEventRepository struct {
+	db database.Service
+}
+
+func NewLoginEventRepository(db database.Service) *LoginEventRepository {
+	return &LoginEventRepository{db: db}
+}
+
+func (r *LoginEventRepository) InitTable() error {
+	query := "CREATE TABLE login_events (id INT NOT NULL, user_id INT NOT NULL, ip VARCHAR(64), user_agent VARCHAR(500), outcome VARCHAR(50), created_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *LoginEventRepository) CreateLoginEvent(params models.CreateLoginEventParams) (*models.LoginEvent, error) {
+	id := nextID()
+	now := time.Now().Unix()
+
+	userAgent := params.UserAgent
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO login_events VALUES (%d, %d, '%s', '%s', '%s', %d)",
+		id, params.UserID, escapeString(params.IP), escapeString(userAgent), escapeString(params.Outcome), now,
+	)
+
+	err := r.db.Execute(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LoginEvent{
+		ID:        id,
+		UserID:    params.UserID,
+		IP:        params.IP,
+		UserAgent: userAgent,
+		Outcome:   params.Outcome,
+		CreatedAt: time.Unix(now, 0),
+	}, nil
+}
+
+func (r *LoginEventRepository) GetRecentByUserID(userID int64, limit int) ([]models.LoginEvent, error) {
+	query := fmt.Sprintf(
+		"SELECT id, user_id, ip, user_agent, outcome, created_at FROM login_events WHERE user_id = %d ORDER BY id DESC LIMIT %d",
+		userID, limit,
+	)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]models.LoginEvent, 0, len(rows))
+	for _, row := range rows {
+		if len(row) < 6 {
+			continue
+		}
+
+		events = append(events, models.LoginEvent{
+			ID:        row[0].(int64),
+			UserID:    row[1].(int64),
+			IP:        row[2].(string),
+			UserAgent: row[3].(string),
+			Outcome:   row[4].(string),
+			CreatedAt: time.Unix(row[5].(int64), 0),
+		})
+	}
+
+	return events, nil
+}
+
+func (r *LoginEventRepository) DeleteByUserID(userID int64) error {
+	query := fmt.Sprintf("DELETE FROM login_events WHERE user_id = %d", userID)
+	return r.db.Execute(query)
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NimbleDB has no ALTER TABLE, so a table that gains columns is rebuilt when
+// the API starts: its rows are read out, the table is dropped and created
+// again with the new schema, and the rows are written back. Columns are only
+// ever added at the end of a table, so a table that has the last one is up
+// to date.
+
+// fillFunc returns the value a row read from an older table gets for a
+// column that table lacked. old holds the row's values by column name.
+type fillFunc func(column string, old map[string]interface{}) (interface{}, error)
+
+// upgradeTable brings an existing table up to the schema in create, whose
+// columns are listed in order in columns. Only one API instance should run
+// while it does: a crash part way through loses the rows not yet written
+// back.
+func upgradeTable(db database.Service, table, create, columns string, fill fillFunc) error {
+	names := strings.Split(columns, ", ")
+
+	_, _, err := db.Query(fmt.Sprintf("SELECT %s FROM %s LIMIT 1", names[len(names)-1], table))
+	if err == nil {
+		return nil
+	}
+	if !strings.Contains(strings.ToLower(err.Error()), "not found") {
+		return err
+	}
+
+	oldColumns, rows, err := db.Query("SELECT * FROM " + table)
+	if err != nil {
+		return err
+	}
+
+	// Every row is converted before the table is dropped, so a row that
+	// can't be leaves the table as it was.
+	inserts := make([]string, 0, len(rows))
+	for _, row := range rows {
+		old := make(map[string]interface{}, len(oldColumns))
+		for i, name := range oldColumns {
+			if i < len(row) {
+				old[name] = row[i]
+			}
+		}
+
+		values := make([]string, 0, len(names))
+		for _, name := range names {
+			value, ok := old[name]
+			if !ok {
+				if value, err = fill(name, old); err != nil {
+					return fmt.Errorf("upgrade %s: %w", table, err)
+				}
+			}
+			values = append(values, sqlLiteral(value))
+		}
+		inserts = append(inserts, fmt.Sprintf("INSERT INTO %s VALUES (%s)", table, strings.Join(values, ", ")))
+	}
+
+	if err := db.Execute("DROP TABLE " + table); err != nil {
+		return fmt.Errorf("upgrade %s: %w", table, err)
+	}
+	if err := db.Execute(create); err != nil {
+		return fmt.Errorf("upgrade %s: %d rows were not written back: %w", table, len(inserts), err)
+	}
+	for i, insert := range inserts {
+		if err := db.Execute(insert); err != nil {
+			return fmt.Errorf("upgrade %s: %d rows were not written back: %w", table, len(inserts)-i, err)
+		}
+	}
+	return nil
+}
+
+// sqlLiteral writes a value read from NimbleDB back as SQL.
+func sqlLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + escapeString(v) + "'"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.Itoa(boolInt(v))
+	default:
+		return fmt.Sprint(v)
+	}
+}
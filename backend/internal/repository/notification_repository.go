@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NotificationRepository stores notifications and the per-user preferences
+// deciding which of them are created. An unread notification has a read_at
+// of 0.
+type NotificationRepository struct {
+	db database.Service
+}
+
+func NewNotificationRepository(db database.Service) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+func (r *NotificationRepository) InitTable() error {
+	queries := []string{
+		"CREATE TABLE notifications (id INT NOT NULL, recipient_id INT NOT NULL, actor_id INT NOT NULL, kind VARCHAR(20), post_id INT, comment_id INT, detail VARCHAR(50), read_at INT, created_at INT, PRIMARY KEY (id))",
+		"CREATE TABLE notification_preferences (user_id INT NOT NULL, comments INT, replies INT, reactions INT, follows INT, updated_at INT, PRIMARY KEY (user_id))",
+	}
+
+	for _, query := range queries {
+		err := r.db.Execute(query)
+		if err != nil {
+			errMsg := strings.ToLower(err.Error())
+			if strings.Contains(errMsg, "already exists") ||
+				strings.Contains(errMsg, "duplicate") ||
+				strings.Contains(errMsg, "exists") {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *NotificationRepository) CreateNotification(n *models.Notification) error {
+	n.ID = nextID()
+	n.CreatedAt = time.Unix(time.Now().Unix(), 0)
+
+	query := fmt.Sprintf(
+		"INSERT INTO notifications VALUES (%d, %d, %d, '%s', %d, %d, '%s', 0, %d)",
+		n.ID, n.RecipientID, n.ActorID, escapeString(n.Kind), n.PostID, n.CommentID,
+		escapeString(n.Detail), n.CreatedAt.Unix(),
+	)
+	return r.db.Execute(query)
+}
+
+// HasNotification reports whether n was sent before, read or not. Used to
+// keep toggling a reaction or a follow from notifying again each time.
+func (r *NotificationRepository) HasNotification(n *models.Notification) (bool, error) {
+	query := fmt.Sprintf(
+		"SELECT id FROM notifications WHERE recipient_id = %d AND actor_id = %d AND kind = '%s' AND post_id = %d AND detail = '%s'",
+		n.RecipientID, n.ActorID, escapeString(n.Kind), n.PostID, escapeString(n.Detail),
+	)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return false, err
+	}
+	return len(rows) > 0, nil
+}
+
+// GetNotifications returns a page of recipientID's notifications, newest
+// first, with the actor and post filled in.
+func (r *NotificationRepository) GetNotifications(recipientID int64, unreadOnly bool, page models.Page) ([]models.Notification, error) {
+	query := fmt.Sprintf(
+		"SELECT %s FROM notifications%s ORDER BY created_at DESC%s",
+		notificationColumns, notificationWhere(recipientID, unreadOnly), limitClause(page),
+	)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows = pageRows(rows, page)
+	notifications := make([]models.Notification, 0, len(rows))
+	for _, row := range rows {
+		n, err := scanNotification(row)
+		if err != nil {
+			continue
+		}
+
+		userQuery := fmt.Sprintf("SELECT name, image FROM users WHERE id = %d", n.ActorID)
+		userRow, err := r.db.QueryRow(userQuery)
+		if err == nil && len(userRow) >= 2 {
+			n.ActorName = userRow[0].(string)
+			n.ActorImage = userRow[1].(string)
+		}
+
+		if n.PostID != 0 {
+			postQuery := fmt.Sprintf("SELECT title, slug FROM posts WHERE id = %d", n.PostID)
+			postRow, err := r.db.QueryRow(postQuery)
+			if err == nil && len(postRow) >= 2 {
+				n.PostTitle = postRow[0].(string)
+				n.PostSlug, _ = postRow[1].(string)
+			}
+		}
+
+		notifications = append(notifications, *n)
+	}
+
+	return notifications, nil
+}
+
+// CountNotifications counts recipientID's notifications. NimbleDB has no
+// COUNT, so the ids are fetched and counted here.
+func (r *NotificationRepository) CountNotifications(recipientID int64, unreadOnly bool) (int, error) {
+	query := "SELECT id FROM notifications" + notificationWhere(recipientID, unreadOnly)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+// MarkRead marks one of recipientID's notifications as read. It returns
+// false when recipientID has no notification with that id; marking a read
+// notification again keeps its original read_at.
+func (r *NotificationRepository) MarkRead(recipientID, id int64) (bool, error) {
+	query := fmt.Sprintf("SELECT read_at FROM notifications WHERE id = %d AND recipient_id = %d", id, recipientID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return false, err
+	}
+	if len(rows) == 0 {
+		return false, nil
+	}
+	if readAt, _ := rows[0][0].(int64); readAt != 0 {
+		return true, nil
+	}
+
+	query = fmt.Sprintf("UPDATE notifications SET read_at = %d WHERE id = %d", time.Now().Unix(), id)
+	return true, r.db.Execute(query)
+}
+
+// MarkAllRead marks every unread notification of recipientID as read and
+// returns how many there were.
+func (r *NotificationRepository) MarkAllRead(recipientID int64) (int64, error) {
+	query := fmt.Sprintf(
+		"UPDATE notifications SET read_at = %d WHERE recipient_id = %d AND read_at = 0",
+		time.Now().Unix(), recipientID,
+	)
+	return r.db.ExecuteAffected(query)
+}
+
+// DeleteByUserID removes the notifications a user received or caused, and
+// their preferences.
+func (r *NotificationRepository) DeleteByUserID(userID int64) error {
+	query := fmt.Sprintf("DELETE FROM notifications WHERE recipient_id = %d OR actor_id = %d", userID, userID)
+	if err := r.db.Execute(query); err != nil {
+		return err
+	}
+
+	query = fmt.Sprintf("DELETE FROM notification_preferences WHERE user_id = %d", userID)
+	return r.db.Execute(query)
+}
+
+// GetPreferences returns userID's preferences, or the defaults when they
+// never changed them.
+func (r *NotificationRepository) GetPreferences(userID int64) (models.NotificationPreferences, error) {
+	query := fmt.Sprintf("SELECT comments, replies, reactions, follows FROM notification_preferences WHERE user_id = %d", userID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return models.NotificationPreferences{}, err
+	}
+	if len(rows) == 0 || len(rows[0]) < 4 {
+		return models.DefaultNotificationPreferences(), nil
+	}
+
+	row := rows[0]
+	return models.NotificationPreferences{
+		Comments:  row[0].(int64) == 1,
+		Replies:   row[1].(int64) == 1,
+		Reactions: row[2].(int64) == 1,
+		Follows:   row[3].(int64) == 1,
+	}, nil
+}
+
+func (r *NotificationRepository) SavePreferences(userID int64, prefs models.NotificationPreferences) error {
+	now := time.Now().Unix()
+
+	query := fmt.Sprintf(
+		"UPDATE notification_preferences SET comments = %d, replies = %d, reactions = %d, follows = %d, updated_at = %d WHERE user_id = %d",
+		boolInt(prefs.Comments), boolInt(prefs.Replies), boolInt(prefs.Reactions), boolInt(prefs.Follows), now, userID,
+	)
+	affected, err := r.db.ExecuteAffected(query)
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	query = fmt.Sprintf(
+		"INSERT INTO notification_preferences VALUES (%d, %d, %d, %d, %d, %d)",
+		userID, boolInt(prefs.Comments), boolInt(prefs.Replies), boolInt(prefs.Reactions), boolInt(prefs.Follows), now,
+	)
+	return r.db.Execute(query)
+}
+
+func notificationWhere(recipientID int64, unreadOnly bool) string {
+	where := fmt.Sprintf(" WHERE recipient_id = %d", recipientID)
+	if unreadOnly {
+		where += " AND read_at = 0"
+	}
+	return where
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+const notificationColumns = "id, recipient_id, actor_id, kind, post_id, comment_id, detail, read_at, created_at"
+
+func scanNotification(row []interface{}) (*models.Notification, error) {
+	if len(row) < 9 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	n := &models.Notification{
+		ID:          row[0].(int64),
+		RecipientID: row[1].(int64),
+		ActorID:     row[2].(int64),
+		Kind:        row[3].(string),
+		PostID:      row[4].(int64),
+		CommentID:   row[5].(int64),
+		Detail:      row[6].(string),
+		CreatedAt:   time.Unix(row[8].(int64), 0),
+	}
+	if readAt := row[7].(int64); readAt != 0 {
+		n.ReadAt = time.Unix(readAt, 0)
+	}
+	return n, nil
+}
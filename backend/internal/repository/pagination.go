@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"backend/internal/models"
+	"fmt"
+)
+
+// NimbleDB supports LIMIT but not OFFSET, so pages are fetched by limiting to
+// the end of the requested window and dropping the leading rows.
+func limitClause(page models.Page) string {
+	if page.Limit <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" LIMIT %d", page.Offset+page.Limit)
+}
+
+func pageRows(rows [][]interface{}, page models.Page) [][]interface{} {
+	if page.Offset <= 0 {
+		return rows
+	}
+	if page.Offset >= len(rows) {
+		return rows[:0]
+	}
+	return rows[page.Offset:]
+}
@@ -3,11 +3,18 @@ package repository
 import (
 	"backend/internal/database"
 	"backend/internal/models"
+	"backend/internal/slug"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
 
+// ErrVersionConflict is returned by conditional writes when the post is no
+// longer at the version the caller read.
+var ErrVersionConflict = errors.New("post was modified by another request")
+
 type PostRepository struct {
 	db database.Service
 }
@@ -17,7 +24,7 @@ func NewPostRepository(db database.Service) *PostRepository {
 }
 
 func (r *PostRepository) InitTable() error {
-	query := "CREATE TABLE posts (id INT NOT NULL, user_id INT NOT NULL, title VARCHAR(255), content VARCHAR(5000), created_at INT, updated_at INT, PRIMARY KEY (id))"
+	query := "CREATE TABLE posts (id INT NOT NULL, user_id INT NOT NULL, title VARCHAR(255), content VARCHAR(5000), created_at INT, updated_at INT, status VARCHAR(20), publish_at INT, version INT, deleted_at INT, format VARCHAR(20), slug VARCHAR(100), PRIMARY KEY (id))"
 
 	err := r.db.Execute(query)
 	if err != nil {
@@ -25,26 +32,61 @@ func (r *PostRepository) InitTable() error {
 		if strings.Contains(errMsg, "already exists") ||
 			strings.Contains(errMsg, "duplicate") ||
 			strings.Contains(errMsg, "exists") {
-			return nil
+			return upgradeTable(r.db, "posts", query, postColumns, legacyPostFill())
 		}
 		return err
 	}
 	return nil
 }
 
+// legacyPostFill fills the columns posts gained after they were written.
+// Those posts were all published when written, at version 1, in plain text.
+// Each gets a slug from its title, unique among the upgraded posts.
+func legacyPostFill() fillFunc {
+	slugs := make(map[string]bool)
+	return func(column string, old map[string]interface{}) (interface{}, error) {
+		switch column {
+		case "status":
+			return models.PostStatusPublished, nil
+		case "publish_at":
+			return old["created_at"], nil
+		case "version":
+			return int64(1), nil
+		case "format":
+			return models.PostFormatPlain, nil
+		case "slug":
+			title, _ := old["title"].(string)
+			base := slug.Make(title)
+			postSlug := base
+			for n := 2; slugs[postSlug]; n++ {
+				postSlug = slug.WithSuffix(base, n)
+			}
+			slugs[postSlug] = true
+			return postSlug, nil
+		}
+		return int64(0), nil
+	}
+}
+
 func (r *PostRepository) CreatePost(params models.CreatePostParams) (*models.Post, error) {
 	id := time.Now().UnixNano() / 1000000
 	now := time.Now().Unix()
 
+	postSlug, err := r.uniqueSlug(params.Title, id)
+	if err != nil {
+		return nil, err
+	}
+
 	title := escapeString(params.Title)
 	content := escapeString(params.Content)
 
 	query := fmt.Sprintf(
-		"INSERT INTO posts VALUES (%d, %d, '%s', '%s', %d, %d)",
-		id, params.UserID, title, content, now, now,
+		"INSERT INTO posts VALUES (%d, %d, '%s', '%s', %d, %d, '%s', %d, 1, 0, '%s', '%s')",
+		id, params.UserID, title, content, now, now, escapeString(params.Status), unixOrZero(params.PublishAt),
+		escapeString(params.Format), escapeString(postSlug),
 	)
 
-	err := r.db.Execute(query)
+	err = r.db.Execute(query)
 	if err != nil {
 		return nil, err
 	}
@@ -56,68 +98,123 @@ func (r *PostRepository) CreatePost(params models.CreatePostParams) (*models.Pos
 		Content:   params.Content,
 		CreatedAt: time.Unix(now, 0),
 		UpdatedAt: time.Unix(now, 0),
+		Status:    params.Status,
+		PublishAt: params.PublishAt,
+		Version:   1,
+		Format:    params.Format,
+		Slug:      postSlug,
 	}, nil
 }
 
-func (r *PostRepository) GetAllPosts() ([]models.Post, error) {
+// GetAllPosts returns a page of the published posts matching filter, most
+// recently published first. filter.Status is ignored.
+func (r *PostRepository) GetAllPosts(filter models.PostFilter, page models.Page) ([]models.Post, error) {
+	filter.Status = models.PostStatusPublished
+	where, ok, err := r.filterClause(filter)
+	if err != nil || !ok {
+		return []models.Post{}, err
+	}
 
-	query := "SELECT id, user_id, title, content, created_at, updated_at FROM posts ORDER BY created_at DESC"
+	query := fmt.Sprintf("SELECT %s FROM posts WHERE %s ORDER BY publish_at DESC", postColumns, where)
+	return r.queryPostPage(query, page)
+}
+
+// GetPopularPosts returns a page of the published posts matching filter,
+// ordered by their total number of reactions and then by publish time.
+// NimbleDB cannot order by a count, so the posts are ranked from their IDs
+// and the reactions table before the page is loaded.
+func (r *PostRepository) GetPopularPosts(filter models.PostFilter, page models.Page) ([]models.Post, error) {
+	filter.Status = models.PostStatusPublished
+	where, ok, err := r.filterClause(filter)
+	if err != nil || !ok {
+		return []models.Post{}, err
+	}
 
-	cols, rows, err := r.db.Query(query)
+	// publish_at is selected because NimbleDB orders by result columns.
+	_, rows, err := r.db.Query(fmt.Sprintf("SELECT id, publish_at FROM posts WHERE %s ORDER BY publish_at DESC", where))
 	if err != nil {
 		return nil, err
 	}
-
-	_ = cols
-
-	posts := make([]models.Post, 0, len(rows))
+	ids := make([]int64, 0, len(rows))
 	for _, row := range rows {
-		if len(row) < 6 {
+		if len(row) < 1 {
 			continue
 		}
+		ids = append(ids, row[0].(int64))
+	}
 
-		post := models.Post{
-			ID:        row[0].(int64),
-			UserID:    row[1].(int64),
-			Title:     row[2].(string),
-			Content:   row[3].(string),
-			CreatedAt: time.Unix(row[4].(int64), 0),
-			UpdatedAt: time.Unix(row[5].(int64), 0),
+	_, rows, err = r.db.Query("SELECT post_id FROM reactions")
+	if err != nil {
+		return nil, err
+	}
+	reactions := make(map[int64]int)
+	for _, row := range rows {
+		if len(row) < 1 {
+			continue
 		}
+		reactions[row[0].(int64)]++
+	}
 
-		userQuery := fmt.Sprintf("SELECT name, email, image FROM users WHERE id = %d", post.UserID)
-		userRow, err := r.db.QueryRow(userQuery)
-		if err == nil && len(userRow) >= 3 {
-			post.AuthorName = userRow[0].(string)
-			post.AuthorEmail = userRow[1].(string)
-			post.AuthorImage = userRow[2].(string)
-		}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return reactions[ids[i]] > reactions[ids[j]]
+	})
 
-		posts = append(posts, post)
+	if page.Offset >= len(ids) {
+		return []models.Post{}, nil
+	}
+	ids = ids[page.Offset:]
+	if page.Limit > 0 && page.Limit < len(ids) {
+		ids = ids[:page.Limit]
 	}
 
+	matches := make([]string, len(ids))
+	for i, id := range ids {
+		matches[i] = fmt.Sprintf("id = %d", id)
+	}
+	query := fmt.Sprintf("SELECT %s FROM posts WHERE %s", postColumns, strings.Join(matches, " OR "))
+	posts, err := r.queryPostPage(query, models.Page{})
+	if err != nil {
+		return nil, err
+	}
+
+	rank := make(map[int64]int, len(ids))
+	for i, id := range ids {
+		rank[id] = i
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return rank[posts[i].ID] < rank[posts[j].ID]
+	})
 	return posts, nil
 }
 
+// CountPosts returns how many published posts match filter. filter.Status is
+// ignored.
+func (r *PostRepository) CountPosts(filter models.PostFilter) (int, error) {
+	filter.Status = models.PostStatusPublished
+	where, ok, err := r.filterClause(filter)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	_, rows, err := r.db.Query(fmt.Sprintf("SELECT id FROM posts WHERE %s", where))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rows), nil
+}
+
 func (r *PostRepository) GetPostByID(id int64) (*models.Post, error) {
-	query := fmt.Sprintf("SELECT id, user_id, title, content, created_at, updated_at FROM posts WHERE id = %d", id)
+	query := fmt.Sprintf("SELECT %s FROM posts WHERE id = %d AND deleted_at = 0", postColumns, id)
 
 	row, err := r.db.QueryRow(query)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(row) < 6 {
-		return nil, fmt.Errorf("invalid row data")
-	}
-
-	post := &models.Post{
-		ID:        row[0].(int64),
-		UserID:    row[1].(int64),
-		Title:     row[2].(string),
-		Content:   row[3].(string),
-		CreatedAt: time.Unix(row[4].(int64), 0),
-		UpdatedAt: time.Unix(row[5].(int64), 0),
+	post, err := scanPost(row)
+	if err != nil {
+		return nil, err
 	}
 
 	userQuery := fmt.Sprintf("SELECT name, email, image FROM users WHERE id = %d", post.UserID)
@@ -128,59 +225,460 @@ func (r *PostRepository) GetPostByID(id int64) (*models.Post, error) {
 		post.AuthorImage = userRow[2].(string)
 	}
 
+	commentCounts, err := r.countComments(fmt.Sprintf(" WHERE post_id = %d", post.ID))
+	if err != nil {
+		return nil, err
+	}
+	post.CommentCount = commentCounts[post.ID]
+
+	reactionCounts, err := r.countReactions(fmt.Sprintf(" WHERE post_id = %d", post.ID))
+	if err != nil {
+		return nil, err
+	}
+	post.ReactionCounts = reactionCounts[post.ID]
+
+	tags, err := r.loadTags(fmt.Sprintf(" WHERE post_id = %d", post.ID))
+	if err != nil {
+		return nil, err
+	}
+	post.Tags = tags[post.ID]
+
 	return post, nil
 }
 
-func (r *PostRepository) GetPostsByUserID(userID int64) ([]models.Post, error) {
-	query := fmt.Sprintf("SELECT id, user_id, title, content, created_at, updated_at FROM posts WHERE user_id = %d ORDER BY created_at DESC", userID)
+func (r *PostRepository) GetPostsByUserID(userID int64, filter models.PostFilter, page models.Page) ([]models.Post, error) {
+	where, ok, err := r.filterClause(filter)
+	if err != nil || !ok {
+		return []models.Post{}, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM posts WHERE user_id = %d AND %s ORDER BY created_at DESC", postColumns, userID, where)
+	query += limitClause(page)
 
-	cols, rows, err := r.db.Query(query)
+	_, rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, err
 	}
+	rows = pageRows(rows, page)
+
+	posts := make([]models.Post, 0, len(rows))
+	for _, row := range rows {
+		post, err := scanPost(row)
+		if err != nil {
+			continue
+		}
+		posts = append(posts, *post)
+	}
+
+	if err := r.loadCountsAndTags(posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (r *PostRepository) CountPostsByUserID(userID int64, filter models.PostFilter) (int, error) {
+	where, ok, err := r.filterClause(filter)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	query := fmt.Sprintf("SELECT id FROM posts WHERE user_id = %d AND %s", userID, where)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rows), nil
+}
+
+// feedJoin selects the published posts of the authors a user follows. The
+// join is done by NimbleDB so only feed posts come back, however many posts
+// other authors have.
+const feedJoin = "FROM posts JOIN follows ON posts.user_id = follows.followee_id " +
+	"WHERE follows.follower_id = %d AND posts.status = '%s' AND posts.deleted_at = 0"
+
+// GetFeed returns a page of posts by the authors userID follows, most
+// recently published first.
+func (r *PostRepository) GetFeed(userID int64, page models.Page) ([]models.Post, error) {
+	// NimbleDB resolves ORDER BY against the result columns, which carry
+	// their unqualified names.
+	query := fmt.Sprintf("SELECT %s "+feedJoin+" ORDER BY publish_at DESC", qualifiedPostColumns, userID, models.PostStatusPublished)
+	return r.queryPostPage(query, page)
+}
+
+func (r *PostRepository) CountFeed(userID int64) (int, error) {
+	query := fmt.Sprintf("SELECT posts.id "+feedJoin, userID, models.PostStatusPublished)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rows), nil
+}
+
+// bookmarksJoin selects the posts userID has saved that they may still see:
+// posts that were unpublished since are kept only for their author.
+const bookmarksJoin = "FROM posts JOIN bookmarks ON posts.id = bookmarks.post_id " +
+	"WHERE bookmarks.saved_by = %d AND posts.deleted_at = 0 AND ( posts.status = '%s' OR posts.user_id = %d )"
+
+// GetBookmarkedPosts returns a page of the posts userID has saved, most
+// recently saved first.
+func (r *PostRepository) GetBookmarkedPosts(userID int64, page models.Page) ([]models.Post, error) {
+	query := fmt.Sprintf("SELECT %s, bookmarks.saved_at "+bookmarksJoin+" ORDER BY saved_at DESC",
+		qualifiedPostColumns, userID, models.PostStatusPublished, userID)
+	return r.queryPostPage(query, page)
+}
+
+func (r *PostRepository) CountBookmarkedPosts(userID int64) (int, error) {
+	query := fmt.Sprintf("SELECT posts.id "+bookmarksJoin, userID, models.PostStatusPublished, userID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return 0, err
+	}
 
-	_ = cols
+	return len(rows), nil
+}
+
+// GetPublishedPosts returns a page of published posts, newest first, by
+// userID or by everyone when userID is 0.
+func (r *PostRepository) GetPublishedPosts(userID int64, page models.Page) ([]models.Post, error) {
+	where := fmt.Sprintf("status = '%s' AND deleted_at = 0", models.PostStatusPublished)
+	if userID != 0 {
+		where += fmt.Sprintf(" AND user_id = %d", userID)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM posts WHERE %s ORDER BY publish_at DESC", postColumns, where)
+	return r.queryPostPage(query, page)
+}
+
+// queryPostPage runs a query selecting postColumns first and returns the
+// requested page with authors, counts and tags filled in.
+func (r *PostRepository) queryPostPage(query string, page models.Page) ([]models.Post, error) {
+	query += limitClause(page)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	rows = pageRows(rows, page)
 
 	posts := make([]models.Post, 0, len(rows))
 	for _, row := range rows {
-		if len(row) < 6 {
+		post, err := scanPost(row)
+		if err != nil {
 			continue
 		}
 
-		posts = append(posts, models.Post{
-			ID:        row[0].(int64),
-			UserID:    row[1].(int64),
-			Title:     row[2].(string),
-			Content:   row[3].(string),
-			CreatedAt: time.Unix(row[4].(int64), 0),
-			UpdatedAt: time.Unix(row[5].(int64), 0),
-		})
+		userQuery := fmt.Sprintf("SELECT name, email, image FROM users WHERE id = %d", post.UserID)
+		userRow, err := r.db.QueryRow(userQuery)
+		if err == nil && len(userRow) >= 3 {
+			post.AuthorName = userRow[0].(string)
+			post.AuthorEmail = userRow[1].(string)
+			post.AuthorImage = userRow[2].(string)
+		}
+
+		posts = append(posts, *post)
 	}
 
+	if err := r.loadCountsAndTags(posts); err != nil {
+		return nil, err
+	}
 	return posts, nil
 }
 
-func (r *PostRepository) UpdatePost(id int64, params models.UpdatePostParams) error {
-	now := time.Now().Unix()
+// loadCountsAndTags fills in the comment count, reaction counts and tags of
+// posts. Each is one query, limited to these posts' rows.
+func (r *PostRepository) loadCountsAndTags(posts []models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
 
-	title := escapeString(params.Title)
-	content := escapeString(params.Content)
+	ids := make([]string, len(posts))
+	for i := range posts {
+		ids[i] = fmt.Sprintf("post_id = %d", posts[i].ID)
+	}
+	where := " WHERE " + strings.Join(ids, " OR ")
+
+	commentCounts, err := r.countComments(where)
+	if err != nil {
+		return err
+	}
+	reactionCounts, err := r.countReactions(where)
+	if err != nil {
+		return err
+	}
+	tags, err := r.loadTags(where)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		post := &posts[i]
+		post.CommentCount = commentCounts[post.ID]
+		post.ReactionCounts = reactionCounts[post.ID]
+		post.Tags = tags[post.ID]
+	}
+	return nil
+}
+
+// UpdatePost overwrites every editable field of a post. It behaves like
+// PatchPost with all fields set.
+func (r *PostRepository) UpdatePost(id int64, params models.UpdatePostParams, expectedVersion int) error {
+	return r.PatchPost(id, models.PostPatch{
+		Title:     &params.Title,
+		Content:   &params.Content,
+		Status:    &params.Status,
+		PublishAt: &params.PublishAt,
+		Format:    &params.Format,
+	}, expectedVersion)
+}
+
+// PatchPost writes the fields set in patch if the post is still at
+// expectedVersion and bumps its version. A new title moves the post to a
+// new slug when it no longer matches the old one. It returns ErrVersionConflict if the
+// post changed in between or no longer exists.
+func (r *PostRepository) PatchPost(id int64, patch models.PostPatch, expectedVersion int) error {
+	assignments := make([]string, 0, 6)
+	if patch.Title != nil {
+		assignments = append(assignments, fmt.Sprintf("title = '%s'", escapeString(*patch.Title)))
+	}
+	if patch.Content != nil {
+		assignments = append(assignments, fmt.Sprintf("content = '%s'", escapeString(*patch.Content)))
+	}
+	if patch.Status != nil {
+		assignments = append(assignments, fmt.Sprintf("status = '%s'", escapeString(*patch.Status)))
+	}
+	if patch.PublishAt != nil {
+		assignments = append(assignments, fmt.Sprintf("publish_at = %d", unixOrZero(*patch.PublishAt)))
+	}
+	if patch.Format != nil {
+		assignments = append(assignments, fmt.Sprintf("format = '%s'", escapeString(*patch.Format)))
+	}
+	if patch.Title != nil {
+		newSlug, err := r.retitleSlug(id, *patch.Title)
+		if err != nil {
+			return err
+		}
+		if newSlug != "" {
+			assignments = append(assignments, fmt.Sprintf("slug = '%s'", escapeString(newSlug)))
+		}
+	}
+	assignments = append(assignments,
+		fmt.Sprintf("updated_at = %d", time.Now().Unix()),
+		fmt.Sprintf("version = %d", expectedVersion+1),
+	)
 
 	query := fmt.Sprintf(
-		"UPDATE posts SET title = '%s', content = '%s', updated_at = %d WHERE id = %d",
-		title, content, now, id,
+		"UPDATE posts SET %s WHERE id = %d AND version = %d AND deleted_at = 0",
+		strings.Join(assignments, ", "), id, expectedVersion,
 	)
 
-	return r.db.Execute(query)
+	affected, err := r.db.ExecuteAffected(query)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
 }
 
-func (r *PostRepository) DeletePost(id int64) error {
-	query := fmt.Sprintf("DELETE FROM posts WHERE id = %d", id)
-	return r.db.Execute(query)
+// DeletePost moves a post to the trash if it is still at expectedVersion.
+// Trashed posts disappear from every read path but keep their comments,
+// reactions, tags and revisions until PurgeDeletedPosts removes them. It
+// returns ErrVersionConflict if the post changed in between or no longer
+// exists.
+func (r *PostRepository) DeletePost(id int64, expectedVersion int) error {
+	query := fmt.Sprintf(
+		"UPDATE posts SET deleted_at = %d, version = %d WHERE id = %d AND version = %d AND deleted_at = 0",
+		time.Now().Unix(), expectedVersion+1, id, expectedVersion,
+	)
+
+	affected, err := r.db.ExecuteAffected(query)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// GetDeletedPostsByUserID lists the user's trashed posts, most recently
+// deleted first.
+func (r *PostRepository) GetDeletedPostsByUserID(userID int64) ([]models.Post, error) {
+	query := fmt.Sprintf("SELECT %s FROM posts WHERE user_id = %d AND deleted_at > 0 ORDER BY deleted_at DESC", postColumns, userID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]models.Post, 0, len(rows))
+	for _, row := range rows {
+		post, err := scanPost(row)
+		if err != nil {
+			continue
+		}
+		posts = append(posts, *post)
+	}
+
+	return posts, nil
+}
+
+func (r *PostRepository) GetDeletedPostByID(id int64) (*models.Post, error) {
+	query := fmt.Sprintf("SELECT %s FROM posts WHERE id = %d AND deleted_at > 0", postColumns, id)
+
+	row, err := r.db.QueryRow(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanPost(row)
+}
+
+// RestorePost takes a post out of the trash. It returns ErrVersionConflict
+// if the post is no longer trashed at expectedVersion.
+func (r *PostRepository) RestorePost(id int64, expectedVersion int) error {
+	query := fmt.Sprintf(
+		"UPDATE posts SET deleted_at = 0, version = %d WHERE id = %d AND version = %d AND deleted_at > 0",
+		expectedVersion+1, id, expectedVersion,
+	)
+
+	affected, err := r.db.ExecuteAffected(query)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// PurgeDeletedPosts permanently removes posts trashed before cutoff along
+// with their comments, reactions, tags and revisions, and returns how many
+// posts it removed.
+func (r *PostRepository) PurgeDeletedPosts(cutoff time.Time) (int, error) {
+	query := fmt.Sprintf("SELECT id FROM posts WHERE deleted_at > 0 AND deleted_at <= %d", cutoff.Unix())
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, row := range rows {
+		if len(row) < 1 {
+			continue
+		}
+		if err := r.purgePost(row[0].(int64)); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// DeletePostsByUserID permanently removes all of a user's posts, trashed or
+// not.
+func (r *PostRepository) DeletePostsByUserID(userID int64) error {
+	query := fmt.Sprintf("SELECT id FROM posts WHERE user_id = %d", userID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if len(row) < 1 {
+			continue
+		}
+		if err := r.purgePost(row[0].(int64)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purgePost hard-deletes a post and the rows other tables keep for it.
+func (r *PostRepository) purgePost(id int64) error {
+	if err := r.db.Execute(fmt.Sprintf("DELETE FROM posts WHERE id = %d", id)); err != nil {
+		return err
+	}
+
+	for _, table := range []string{"comments", "reactions", "post_tags", "post_revisions", "post_slugs", "bookmarks", "notifications"} {
+		query := fmt.Sprintf("DELETE FROM %s WHERE post_id = %d", table, id)
+		if err := r.db.Execute(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countComments tallies comments per post in a single query. NimbleDB has no
+// COUNT, so the post_id column is fetched and counted here.
+func (r *PostRepository) countComments(where string) (map[int64]int, error) {
+	_, rows, err := r.db.Query("SELECT post_id FROM comments" + where)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]int)
+	for _, row := range rows {
+		if len(row) < 1 {
+			continue
+		}
+		counts[row[0].(int64)]++
+	}
+
+	return counts, nil
+}
+
+// PublishDuePosts publishes every scheduled post whose publish_at has passed
+// and returns their IDs. Publishing bumps the version like any other update;
+// a post edited while it is being published is left for the next run.
+func (r *PostRepository) PublishDuePosts(now time.Time) ([]int64, error) {
+	query := fmt.Sprintf(
+		"SELECT id, version FROM posts WHERE status = '%s' AND publish_at <= %d AND deleted_at = 0",
+		models.PostStatusScheduled, now.Unix(),
+	)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var published []int64
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		id := row[0].(int64)
+		version := row[1].(int64)
+
+		query := fmt.Sprintf(
+			"UPDATE posts SET status = '%s', version = %d WHERE id = %d AND version = %d",
+			models.PostStatusPublished, version+1, id, version,
+		)
+		affected, err := r.db.ExecuteAffected(query)
+		if err != nil {
+			return published, err
+		}
+		if affected > 0 {
+			published = append(published, id)
+		}
+	}
+
+	return published, nil
 }
 
 func (r *PostRepository) CheckPostOwnership(postID, userID int64) (bool, error) {
-	query := fmt.Sprintf("SELECT user_id FROM posts WHERE id = %d", postID)
+	query := fmt.Sprintf("SELECT user_id FROM posts WHERE id = %d AND deleted_at = 0", postID)
 
 	row, err := r.db.QueryRow(query)
 	if err != nil {
@@ -194,3 +692,156 @@ func (r *PostRepository) CheckPostOwnership(postID, userID int64) (bool, error)
 	ownerID := row[0].(int64)
 	return ownerID == userID, nil
 }
+
+// countReactions tallies reactions per post and kind in a single query.
+func (r *PostRepository) countReactions(where string) (map[int64]map[string]int, error) {
+	_, rows, err := r.db.Query("SELECT post_id, kind FROM reactions" + where)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]map[string]int)
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		postID := row[0].(int64)
+		if counts[postID] == nil {
+			counts[postID] = make(map[string]int)
+		}
+		counts[postID][row[1].(string)]++
+	}
+
+	return counts, nil
+}
+
+// loadTags returns the tags of each post, sorted by name.
+func (r *PostRepository) loadTags(where string) (map[int64][]string, error) {
+	_, rows, err := r.db.Query("SELECT post_id, tag FROM post_tags" + where)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[int64][]string)
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		postID := row[0].(int64)
+		tags[postID] = append(tags[postID], row[1].(string))
+	}
+
+	for _, postTags := range tags {
+		sort.Strings(postTags)
+	}
+
+	return tags, nil
+}
+
+// postIDsWithTags returns the IDs of posts carrying every one of the tags.
+func (r *PostRepository) postIDsWithTags(tags []string) ([]int64, error) {
+	var matches map[int64]bool
+	for _, tag := range tags {
+		query := fmt.Sprintf("SELECT post_id FROM post_tags WHERE tag = '%s'", escapeString(tag))
+
+		_, rows, err := r.db.Query(query)
+		if err != nil {
+			return nil, err
+		}
+
+		tagged := make(map[int64]bool, len(rows))
+		for _, row := range rows {
+			if len(row) < 1 {
+				continue
+			}
+			postID := row[0].(int64)
+			if matches == nil || matches[postID] {
+				tagged[postID] = true
+			}
+		}
+
+		matches = tagged
+		if len(matches) == 0 {
+			break
+		}
+	}
+
+	ids := make([]int64, 0, len(matches))
+	for id := range matches {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// filterClause turns filter into a WHERE condition. ok is false when no post
+// can match, so the caller can skip the query.
+func (r *PostRepository) filterClause(filter models.PostFilter) (string, bool, error) {
+	conditions := []string{"deleted_at = 0"}
+
+	if filter.Status != "" {
+		conditions = append(conditions, fmt.Sprintf("status = '%s'", escapeString(filter.Status)))
+	}
+
+	if len(filter.Tags) > 0 {
+		ids, err := r.postIDsWithTags(filter.Tags)
+		if err != nil {
+			return "", false, err
+		}
+		if len(ids) == 0 {
+			return "", false, nil
+		}
+
+		matches := make([]string, 0, len(ids))
+		for _, id := range ids {
+			matches = append(matches, fmt.Sprintf("id = %d", id))
+		}
+		conditions = append(conditions, "( "+strings.Join(matches, " OR ")+" )")
+	}
+
+	return strings.Join(conditions, " AND "), true, nil
+}
+
+const postColumns = "id, user_id, title, content, created_at, updated_at, status, publish_at, version, deleted_at, format, slug"
+
+// qualifiedPostColumns is postColumns for queries that join posts with
+// another table.
+var qualifiedPostColumns = "posts." + strings.ReplaceAll(postColumns, ", ", ", posts.")
+
+func scanPost(row []interface{}) (*models.Post, error) {
+	if len(row) < 12 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	post := &models.Post{
+		ID:        row[0].(int64),
+		UserID:    row[1].(int64),
+		Title:     row[2].(string),
+		Content:   row[3].(string),
+		CreatedAt: time.Unix(row[4].(int64), 0),
+		UpdatedAt: time.Unix(row[5].(int64), 0),
+		Status:    row[6].(string),
+		Version:   int(row[8].(int64)),
+		Format:    models.PostFormatPlain,
+	}
+	if publishAt, _ := row[7].(int64); publishAt > 0 {
+		post.PublishAt = time.Unix(publishAt, 0)
+	}
+	if deletedAt, _ := row[9].(int64); deletedAt > 0 {
+		post.DeletedAt = time.Unix(deletedAt, 0)
+	}
+	if format, _ := row[10].(string); format != "" {
+		post.Format = format
+	}
+	post.Slug, _ = row[11].(string)
+
+	return post, nil
+}
+
+// unixOrZero stores a zero time as 0 rather than the large negative Unix
+// value of Go's zero time.
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"backend/internal/models"
+	"backend/internal/slug"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Posts keep their current slug in posts.slug. Slugs a post had before its
+// title changed are kept in post_slugs so old links can be redirected; they
+// stay reserved for that post.
+
+func (r *PostRepository) InitSlugTable() error {
+	query := "CREATE TABLE post_slugs (id INT NOT NULL, post_id INT NOT NULL, slug VARCHAR(100), created_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// GetPostBySlug returns the post whose current slug is postSlug.
+func (r *PostRepository) GetPostBySlug(postSlug string) (*models.Post, error) {
+	query := fmt.Sprintf("SELECT id FROM posts WHERE slug = '%s' AND deleted_at = 0", escapeString(postSlug))
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) < 1 {
+		return nil, fmt.Errorf("post not found")
+	}
+
+	return r.GetPostByID(rows[0][0].(int64))
+}
+
+// GetPostByOldSlug returns the post that used to be reachable at postSlug.
+func (r *PostRepository) GetPostByOldSlug(postSlug string) (*models.Post, error) {
+	query := fmt.Sprintf("SELECT post_id FROM post_slugs WHERE slug = '%s'", escapeString(postSlug))
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) < 1 {
+		return nil, fmt.Errorf("post not found")
+	}
+
+	return r.GetPostByID(rows[0][0].(int64))
+}
+
+// uniqueSlug derives a slug from title that no other post uses now or used
+// before, adding -2, -3, ... on collisions.
+func (r *PostRepository) uniqueSlug(title string, postID int64) (string, error) {
+	base := slug.Make(title)
+
+	candidate := base
+	for n := 2; ; n++ {
+		taken, err := r.slugTaken(candidate, postID)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+		if n > 100 {
+			// Past this many collisions the ID is unique on its own.
+			return slug.WithSuffix(base, int(postID)), nil
+		}
+		candidate = slug.WithSuffix(base, n)
+	}
+}
+
+// slugTaken reports whether a post other than postID holds postSlug, as its
+// current slug or an old one.
+func (r *PostRepository) slugTaken(postSlug string, postID int64) (bool, error) {
+	escaped := escapeString(postSlug)
+
+	_, rows, err := r.db.Query(fmt.Sprintf("SELECT id FROM posts WHERE slug = '%s'", escaped))
+	if err != nil {
+		return false, err
+	}
+	for _, row := range rows {
+		if len(row) > 0 && row[0].(int64) != postID {
+			return true, nil
+		}
+	}
+
+	_, rows, err = r.db.Query(fmt.Sprintf("SELECT post_id FROM post_slugs WHERE slug = '%s'", escaped))
+	if err != nil {
+		return false, err
+	}
+	for _, row := range rows {
+		if len(row) > 0 && row[0].(int64) != postID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// retitleSlug returns the slug post id should move to for title, or "" if its
+// current slug still fits. The current slug is kept in post_slugs before the
+// caller switches, so a failed update leaves at most a redundant redirect.
+func (r *PostRepository) retitleSlug(id int64, title string) (string, error) {
+	_, rows, err := r.db.Query(fmt.Sprintf("SELECT slug FROM posts WHERE id = %d", id))
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 || len(rows[0]) < 1 {
+		return "", fmt.Errorf("post not found")
+	}
+	current, _ := rows[0][0].(string)
+
+	if current != "" && slug.HasBase(current, slug.Make(title)) {
+		return "", nil
+	}
+
+	newSlug, err := r.uniqueSlug(title, id)
+	if err != nil {
+		return "", err
+	}
+	if current == "" || current == newSlug {
+		return newSlug, nil
+	}
+
+	if err := r.keepOldSlug(id, current); err != nil {
+		return "", err
+	}
+	return newSlug, nil
+}
+
+func (r *PostRepository) keepOldSlug(postID int64, oldSlug string) error {
+	query := fmt.Sprintf(
+		"SELECT id FROM post_slugs WHERE post_id = %d AND slug = '%s'",
+		postID, escapeString(oldSlug),
+	)
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		return nil
+	}
+
+	return r.db.Execute(fmt.Sprintf(
+		"INSERT INTO post_slugs VALUES (%d, %d, '%s', %d)",
+		nextID(), postID, escapeString(oldSlug), time.Now().Unix(),
+	))
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReactionRepository stores one row per (post_id, user_id, kind), which
+// AddReaction keeps unique with insertUnique.
+type ReactionRepository struct {
+	db database.Service
+}
+
+func NewReactionRepository(db database.Service) *ReactionRepository {
+	return &ReactionRepository{db: db}
+}
+
+func (r *ReactionRepository) InitTable() error {
+	query := "CREATE TABLE reactions (id INT NOT NULL, post_id INT NOT NULL, user_id INT NOT NULL, kind VARCHAR(20), created_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// AddReaction records the reaction unless the user already left it, so
+// repeated calls are no-ops.
+func (r *ReactionRepository) AddReaction(postID, userID int64, kind string) error {
+	exists := fmt.Sprintf(
+		"SELECT id FROM reactions WHERE post_id = %d AND user_id = %d AND kind = '%s'",
+		postID, userID, escapeString(kind),
+	)
+	key := fmt.Sprintf("reaction:%d:%d:%s", postID, userID, kind)
+
+	return insertUnique(r.db, key, exists, func(id int64) string {
+		return fmt.Sprintf(
+			"INSERT INTO reactions VALUES (%d, %d, %d, '%s', %d)",
+			id, postID, userID, escapeString(kind), time.Now().Unix(),
+		)
+	})
+}
+
+func (r *ReactionRepository) RemoveReaction(postID, userID int64, kind string) error {
+	query := fmt.Sprintf(
+		"DELETE FROM reactions WHERE post_id = %d AND user_id = %d AND kind = '%s'",
+		postID, userID, escapeString(kind),
+	)
+	return r.db.Execute(query)
+}
+
+// GetKindsByUserID returns the reaction kinds the user left, keyed by post ID.
+func (r *ReactionRepository) GetKindsByUserID(userID int64) (map[int64][]string, error) {
+	query := fmt.Sprintf("SELECT post_id, kind FROM reactions WHERE user_id = %d", userID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := make(map[int64][]string)
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		postID := row[0].(int64)
+		kinds[postID] = append(kinds[postID], row[1].(string))
+	}
+
+	return kinds, nil
+}
+
+func (r *ReactionRepository) DeleteByUserID(userID int64) error {
+	query := fmt.Sprintf("DELETE FROM reactions WHERE user_id = %d", userID)
+	return r.db.Execute(query)
+}
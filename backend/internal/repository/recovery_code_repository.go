@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type RecoveryCodeRepository struct {
+	db database.Service
+}
+
+func NewRecoveryCodeRepository(db database.Service) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{db: db}
+}
+
+func (r *RecoveryCodeRepository) InitTable() error {
+	query := "CREATE TABLE recovery_codes (id INT NOT NULL, user_id INT NOT NULL, code_hash VARCHAR(64), used_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// ReplaceCodes discards any previous recovery codes of the user and stores
+// the given hashes as the new set.
+func (r *RecoveryCodeRepository) ReplaceCodes(userID int64, codeHashes []string) error {
+	if err := r.DeleteByUserID(userID); err != nil {
+		return err
+	}
+
+	for _, codeHash := range codeHashes {
+		query := fmt.Sprintf(
+			"INSERT INTO recovery_codes VALUES (%d, %d, '%s', 0)",
+			nextID(), userID, escapeString(codeHash),
+		)
+		if err := r.db.Execute(query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindCode returns the ID of the user's unused recovery code with the given
+// hash, and whether there is one.
+func (r *RecoveryCodeRepository) FindCode(userID int64, codeHash string) (int64, bool, error) {
+	query := fmt.Sprintf(
+		"SELECT id FROM recovery_codes WHERE user_id = %d AND code_hash = '%s' AND used_at = 0",
+		userID, escapeString(codeHash),
+	)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(rows) == 0 || len(rows[0]) < 1 {
+		return 0, false, nil
+	}
+
+	return rows[0][0].(int64), true, nil
+}
+
+// UseCode marks a recovery code as used and reports whether it was still
+// unused, so that of two requests using the same code only one succeeds.
+func (r *RecoveryCodeRepository) UseCode(id int64) (bool, error) {
+	query := fmt.Sprintf(
+		"UPDATE recovery_codes SET used_at = %d WHERE id = %d AND used_at = 0",
+		time.Now().Unix(), id,
+	)
+
+	affected, err := r.db.ExecuteAffected(query)
+	return affected > 0, err
+}
+
+func (r *RecoveryCodeRepository) DeleteByUserID(userID int64) error {
+	query := fmt.Sprintf("DELETE FROM recovery_codes WHERE user_id = %d", userID)
+	return r.db.Execute(query)
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RevisionRepository keeps a numbered snapshot of a post's title and content
+// for every edit. Rev 1 is the post as first written.
+type RevisionRepository struct {
+	db database.Service
+}
+
+func NewRevisionRepository(db database.Service) *RevisionRepository {
+	return &RevisionRepository{db: db}
+}
+
+func (r *RevisionRepository) InitTable() error {
+	query := "CREATE TABLE post_revisions (id INT NOT NULL, post_id INT NOT NULL, rev INT NOT NULL, title VARCHAR(255), content VARCHAR(5000), created_at INT, PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// CreateRevision appends a snapshot with the next revision number.
+func (r *RevisionRepository) CreateRevision(postID int64, title, content string, createdAt time.Time) (*models.PostRevision, error) {
+	latest, err := r.LatestRev(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	id := nextID()
+	rev := latest + 1
+
+	query := fmt.Sprintf(
+		"INSERT INTO post_revisions VALUES (%d, %d, %d, '%s', '%s', %d)",
+		id, postID, rev, escapeString(title), escapeString(content), createdAt.Unix(),
+	)
+
+	if err := r.db.Execute(query); err != nil {
+		return nil, err
+	}
+
+	return &models.PostRevision{
+		ID:        id,
+		PostID:    postID,
+		Rev:       rev,
+		Title:     title,
+		Content:   content,
+		CreatedAt: time.Unix(createdAt.Unix(), 0),
+	}, nil
+}
+
+func (r *RevisionRepository) DeleteRevision(id int64) error {
+	return r.db.Execute(fmt.Sprintf("DELETE FROM post_revisions WHERE id = %d", id))
+}
+
+// LatestRev returns the highest revision number of a post, or 0 if it has
+// none.
+func (r *RevisionRepository) LatestRev(postID int64) (int, error) {
+	query := fmt.Sprintf("SELECT rev FROM post_revisions WHERE post_id = %d ORDER BY rev DESC LIMIT 1", postID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(rows) == 0 || len(rows[0]) < 1 {
+		return 0, nil
+	}
+	return int(rows[0][0].(int64)), nil
+}
+
+// GetRevisionsByPostID lists revisions newest first.
+func (r *RevisionRepository) GetRevisionsByPostID(postID int64) ([]models.PostRevision, error) {
+	query := fmt.Sprintf("SELECT %s FROM post_revisions WHERE post_id = %d ORDER BY rev DESC", revisionColumns, postID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]models.PostRevision, 0, len(rows))
+	for _, row := range rows {
+		revision, err := scanRevision(row)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, *revision)
+	}
+
+	return revisions, nil
+}
+
+func (r *RevisionRepository) GetRevision(postID int64, rev int) (*models.PostRevision, error) {
+	query := fmt.Sprintf("SELECT %s FROM post_revisions WHERE post_id = %d AND rev = %d", revisionColumns, postID, rev)
+
+	row, err := r.db.QueryRow(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRevision(row)
+}
+
+const revisionColumns = "id, post_id, rev, title, content, created_at"
+
+func scanRevision(row []interface{}) (*models.PostRevision, error) {
+	if len(row) < 6 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	return &models.PostRevision{
+		ID:        row[0].(int64),
+		PostID:    row[1].(int64),
+		Rev:       int(row[2].(int64)),
+		Title:     row[3].(string),
+		Content:   row[4].(string),
+		CreatedAt: time.Unix(row[5].(int64), 0),
+	}, nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type TagRepository struct {
+	db database.Service
+}
+
+func NewTagRepository(db database.Service) *TagRepository {
+	return &TagRepository{db: db}
+}
+
+func (r *TagRepository) InitTable() error {
+	query := "CREATE TABLE post_tags (id INT NOT NULL, post_id INT NOT NULL, tag VARCHAR(50), PRIMARY KEY (id))"
+
+	err := r.db.Execute(query)
+	if err != nil {
+		errMsg := strings.ToLower(err.Error())
+		if strings.Contains(errMsg, "already exists") ||
+			strings.Contains(errMsg, "duplicate") ||
+			strings.Contains(errMsg, "exists") {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// SetPostTags replaces the tags of a post, touching only the rows that change.
+func (r *TagRepository) SetPostTags(postID int64, tags []string) error {
+	current, err := r.GetTagsByPostID(postID)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		wanted[tag] = true
+	}
+
+	existing := make(map[string]bool, len(current))
+	for _, tag := range current {
+		existing[tag] = true
+		if wanted[tag] {
+			continue
+		}
+
+		query := fmt.Sprintf("DELETE FROM post_tags WHERE post_id = %d AND tag = '%s'", postID, escapeString(tag))
+		if err := r.db.Execute(query); err != nil {
+			return err
+		}
+	}
+
+	for _, tag := range tags {
+		if existing[tag] {
+			continue
+		}
+
+		query := fmt.Sprintf("INSERT INTO post_tags VALUES (%d, %d, '%s')", nextID(), postID, escapeString(tag))
+		if err := r.db.Execute(query); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *TagRepository) GetTagsByPostID(postID int64) ([]string, error) {
+	query := fmt.Sprintf("SELECT tag FROM post_tags WHERE post_id = %d", postID)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if len(row) < 1 {
+			continue
+		}
+		tags = append(tags, row[0].(string))
+	}
+
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// GetTagCounts lists every tag on a published post with the number of such
+// posts carrying it, most used first. Drafts and trashed posts don't count.
+func (r *TagRepository) GetTagCounts() ([]models.TagCount, error) {
+	query := fmt.Sprintf(
+		"SELECT post_tags.tag FROM post_tags JOIN posts ON post_tags.post_id = posts.id WHERE posts.status = '%s' AND posts.deleted_at = 0",
+		models.PostStatusPublished,
+	)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, row := range rows {
+		if len(row) < 1 {
+			continue
+		}
+		counts[row[0].(string)]++
+	}
+
+	tagCounts := make([]models.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tagCounts = append(tagCounts, models.TagCount{Tag: tag, Count: count})
+	}
+
+	sort.Slice(tagCounts, func(i, j int) bool {
+		if tagCounts[i].Count != tagCounts[j].Count {
+			return tagCounts[i].Count > tagCounts[j].Count
+		}
+		return tagCounts[i].Tag < tagCounts[j].Tag
+	})
+
+	return tagCounts, nil
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// maxRowLives bounds how many times insertUnique can bring back the same
+// row, and so how long its search for a free ID takes.
+const maxRowLives = 1000
+
+// insertUnique inserts a row unless a query for it, exists, returns one.
+// NimbleDB has no composite unique keys or transactions, so the row's ID is
+// derived from key, which names the row among all tables: two requests
+// inserting the same row at once collide on the primary key, and the loser
+// finds the winner's row with exists. A deleted row keeps its primary key,
+// so the ID also counts the row's earlier lives, and a collision with no
+// live row behind it moves on to the next. insert builds the INSERT for an
+// ID.
+func insertUnique(db database.Service, key, exists string, insert func(id int64) string) error {
+	for generation := 0; generation < maxRowLives; generation++ {
+		_, rows, err := db.Query(exists)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			return nil
+		}
+
+		err = db.Execute(insert(uniqueID(key, generation)))
+		if err == nil || !isUniqueViolation(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("%s was added and removed too many times", key)
+}
+
+// uniqueID hashes key and generation into a positive ID.
+func uniqueID(key string, generation int) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s#%d", key, generation)
+	return int64(h.Sum64() >> 1)
+}
+
+func isUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "unique constraint violation")
+}
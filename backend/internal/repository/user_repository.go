@@ -17,7 +17,7 @@ func NewUserRepository(db database.Service) *UserRepository {
 }
 
 func (r *UserRepository) InitTable() error {
-	query := "CREATE TABLE users (id INT NOT NULL, email VARCHAR(255), password VARCHAR(255), name VARCHAR(255), image VARCHAR(500), role VARCHAR(50), created_at INT, PRIMARY KEY (id))"
+	query := "CREATE TABLE users (id INT NOT NULL, email VARCHAR(255), password VARCHAR(255), name VARCHAR(255), image VARCHAR(500), role VARCHAR(50), created_at INT, failed_logins INT, locked_until INT, totp_secret VARCHAR(64), totp_enabled INT, totp_last_step INT, session_version INT, PRIMARY KEY (id))"
 
 	err := r.db.Execute(query)
 	if err != nil {
@@ -26,13 +26,23 @@ func (r *UserRepository) InitTable() error {
 		if strings.Contains(errMsg, "already exists") ||
 			strings.Contains(errMsg, "duplicate") ||
 			strings.Contains(errMsg, "exists") {
-			return nil
+			return upgradeTable(r.db, "users", query, userColumns, fillUserColumn)
 		}
 		return err
 	}
 	return nil
 }
 
+// fillUserColumn fills the columns users gained after they signed up: none
+// of them had failed logins, two-factor authentication or a password change
+// then.
+func fillUserColumn(column string, old map[string]interface{}) (interface{}, error) {
+	if column == "totp_secret" {
+		return "", nil
+	}
+	return int64(0), nil
+}
+
 func (r *UserRepository) CreateUser(params models.CreateUserParams) (*models.User, error) {
 
 	id := time.Now().UnixNano() / 1000000
@@ -44,7 +54,7 @@ func (r *UserRepository) CreateUser(params models.CreateUserParams) (*models.Use
 	image := escapeString(params.Image)
 
 	query := fmt.Sprintf(
-		"INSERT INTO users VALUES (%d, '%s', '%s', '%s', '%s', 'user', %d)",
+		"INSERT INTO users VALUES (%d, '%s', '%s', '%s', '%s', 'user', %d, 0, 0, '', 0, 0, 0)",
 		id, email, password, name, image, createdAt,
 	)
 
@@ -66,53 +76,134 @@ func (r *UserRepository) CreateUser(params models.CreateUserParams) (*models.Use
 
 func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
 	email = escapeString(email)
-	query := fmt.Sprintf("SELECT id, email, password, name, image, role, created_at FROM users WHERE email = '%s'", email)
+	query := fmt.Sprintf("SELECT %s FROM users WHERE email = '%s'", userColumns, email)
 
 	row, err := r.db.QueryRow(query)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(row) < 7 {
-		return nil, fmt.Errorf("invalid row data")
-	}
-
-	createdAtUnix := row[6].(int64)
-
-	return &models.User{
-		ID:        row[0].(int64),
-		Email:     row[1].(string),
-		Password:  row[2].(string),
-		Name:      row[3].(string),
-		Image:     row[4].(string),
-		Role:      row[5].(string),
-		CreatedAt: time.Unix(createdAtUnix, 0),
-	}, nil
+	return scanUser(row)
 }
 
 func (r *UserRepository) GetUserById(id int64) (*models.User, error) {
-	query := fmt.Sprintf("SELECT id, email, password, name, image, role, created_at FROM users WHERE id = %d", id)
+	query := fmt.Sprintf("SELECT %s FROM users WHERE id = %d", userColumns, id)
 
 	row, err := r.db.QueryRow(query)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(row) < 7 {
-		return nil, fmt.Errorf("invalid row data")
+	return scanUser(row)
+}
+
+func (r *UserRepository) UpdateUser(id int64, params models.UpdateUserParams) error {
+	query := fmt.Sprintf(
+		"UPDATE users SET email = '%s', name = '%s', image = '%s' WHERE id = %d",
+		escapeString(params.Email), escapeString(params.Name), escapeString(params.Image), id,
+	)
+
+	return r.db.Execute(query)
+}
+
+// UpdatePassword sets the password hash and the session version, which
+// callers bump so that sessions from before the change end.
+func (r *UserRepository) UpdatePassword(id int64, hashedPassword string, sessionVersion int64) error {
+	query := fmt.Sprintf(
+		"UPDATE users SET password = '%s', session_version = %d WHERE id = %d",
+		escapeString(hashedPassword), sessionVersion, id,
+	)
+	return r.db.Execute(query)
+}
+
+func (r *UserRepository) DeleteUser(id int64) error {
+	query := fmt.Sprintf("DELETE FROM users WHERE id = %d", id)
+	return r.db.Execute(query)
+}
+
+func (r *UserRepository) SetLoginFailures(id int64, failures int, lockedUntil time.Time) error {
+	var lockedUntilUnix int64
+	if !lockedUntil.IsZero() {
+		lockedUntilUnix = lockedUntil.Unix()
 	}
 
-	createdAtUnix := row[6].(int64)
+	query := fmt.Sprintf(
+		"UPDATE users SET failed_logins = %d, locked_until = %d WHERE id = %d",
+		failures, lockedUntilUnix, id,
+	)
+
+	return r.db.Execute(query)
+}
 
-	return &models.User{
+func (r *UserRepository) ResetLoginFailures(id int64) error {
+	return r.SetLoginFailures(id, 0, time.Time{})
+}
+
+func (r *UserRepository) SetTOTPSecret(id int64, secret string) error {
+	query := fmt.Sprintf(
+		"UPDATE users SET totp_secret = '%s', totp_enabled = 0 WHERE id = %d",
+		escapeString(secret), id,
+	)
+
+	return r.db.Execute(query)
+}
+
+func (r *UserRepository) EnableTOTP(id int64) error {
+	query := fmt.Sprintf("UPDATE users SET totp_enabled = 1 WHERE id = %d", id)
+	return r.db.Execute(query)
+}
+
+// AdvanceTOTPStep moves the user's last accepted TOTP step from from to to.
+// It reports false if the step is no longer from, meaning another request
+// has used a second factor in between.
+func (r *UserRepository) AdvanceTOTPStep(id, from, to int64) (bool, error) {
+	query := fmt.Sprintf(
+		"UPDATE users SET totp_last_step = %d WHERE id = %d AND totp_last_step = %d",
+		to, id, from,
+	)
+
+	affected, err := r.db.ExecuteAffected(query)
+	return affected > 0, err
+}
+
+func (r *UserRepository) DisableTOTP(id int64) error {
+	query := fmt.Sprintf("UPDATE users SET totp_secret = '', totp_enabled = 0 WHERE id = %d", id)
+	return r.db.Execute(query)
+}
+
+const userColumns = "id, email, password, name, image, role, created_at, failed_logins, locked_until, totp_secret, totp_enabled, totp_last_step, session_version"
+
+func scanUser(row []interface{}) (*models.User, error) {
+	if len(row) < 13 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	user := &models.User{
 		ID:        row[0].(int64),
 		Email:     row[1].(string),
 		Password:  row[2].(string),
 		Name:      row[3].(string),
 		Image:     row[4].(string),
 		Role:      row[5].(string),
-		CreatedAt: time.Unix(createdAtUnix, 0),
-	}, nil
+		CreatedAt: time.Unix(row[6].(int64), 0),
+	}
+
+	if failures, ok := row[7].(int64); ok {
+		user.FailedLogins = int(failures)
+	}
+	if lockedUntil, ok := row[8].(int64); ok && lockedUntil > 0 {
+		user.LockedUntil = time.Unix(lockedUntil, 0)
+	}
+	if secret, ok := row[9].(string); ok {
+		user.TOTPSecret = secret
+	}
+	if enabled, ok := row[10].(int64); ok {
+		user.TOTPEnabled = enabled == 1
+	}
+	user.TOTPLastStep, _ = row[11].(int64)
+	user.SessionVersion, _ = row[12].(int64)
+
+	return user, nil
 }
 
 func escapeString(s string) string {
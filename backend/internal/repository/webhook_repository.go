@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"backend/internal/webhook"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// WebhookRepository stores webhook subscriptions, the outbox of events to be
+// fanned out to them and the log of deliveries. The work itself runs on the
+// job queue.
+type WebhookRepository struct {
+	db database.Service
+}
+
+func NewWebhookRepository(db database.Service) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+func (r *WebhookRepository) InitTable() error {
+	queries := []string{
+		"CREATE TABLE webhooks (id INT NOT NULL, url VARCHAR(500), secret VARCHAR(100), events VARCHAR(255), active INT, created_by INT, created_at INT, PRIMARY KEY (id))",
+		fmt.Sprintf("CREATE TABLE webhook_outbox (id INT NOT NULL, event_type VARCHAR(50), payload VARCHAR(%d), created_at INT, dispatched_at INT, PRIMARY KEY (id))", webhook.MaxPayloadLength),
+		"CREATE TABLE webhook_deliveries (id INT NOT NULL, webhook_id INT NOT NULL, event_id INT NOT NULL, event_type VARCHAR(50), status VARCHAR(20), attempts INT, next_attempt_at INT, response_code INT, last_error VARCHAR(500), created_at INT, updated_at INT, PRIMARY KEY (id))",
+	}
+
+	for _, query := range queries {
+		err := r.db.Execute(query)
+		if err != nil {
+			errMsg := strings.ToLower(err.Error())
+			if strings.Contains(errMsg, "already exists") ||
+				strings.Contains(errMsg, "duplicate") ||
+				strings.Contains(errMsg, "exists") {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *WebhookRepository) CreateWebhook(url, secret string, events []string, createdBy int64) (*models.Webhook, error) {
+	webhook := &models.Webhook{
+		ID:        nextID(),
+		URL:       url,
+		Secret:    secret,
+		Events:    events,
+		Active:    true,
+		CreatedBy: createdBy,
+		CreatedAt: time.Unix(time.Now().Unix(), 0),
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO webhooks VALUES (%d, '%s', '%s', '%s', 1, %d, %d)",
+		webhook.ID, escapeString(url), escapeString(secret), escapeString(strings.Join(events, ",")),
+		createdBy, webhook.CreatedAt.Unix(),
+	)
+	if err := r.db.Execute(query); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (r *WebhookRepository) GetWebhooks() ([]models.Webhook, error) {
+	_, rows, err := r.db.Query("SELECT " + webhookColumns + " FROM webhooks ORDER BY created_at ASC")
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]models.Webhook, 0, len(rows))
+	for _, row := range rows {
+		webhook, err := scanWebhook(row)
+		if err != nil {
+			continue
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, nil
+}
+
+func (r *WebhookRepository) GetWebhookByID(id int64) (*models.Webhook, error) {
+	row, err := r.db.QueryRow(fmt.Sprintf("SELECT %s FROM webhooks WHERE id = %d", webhookColumns, id))
+	if err != nil {
+		return nil, err
+	}
+	return scanWebhook(row)
+}
+
+// UpdateWebhook saves the URL, events and active flag of webhook.
+func (r *WebhookRepository) UpdateWebhook(webhook *models.Webhook) error {
+	query := fmt.Sprintf(
+		"UPDATE webhooks SET url = '%s', events = '%s', active = %d WHERE id = %d",
+		escapeString(webhook.URL), escapeString(strings.Join(webhook.Events, ",")), boolInt(webhook.Active), webhook.ID,
+	)
+	return r.db.Execute(query)
+}
+
+// DeleteWebhook removes a webhook and its delivery log.
+func (r *WebhookRepository) DeleteWebhook(id int64) error {
+	if err := r.db.Execute(fmt.Sprintf("DELETE FROM webhooks WHERE id = %d", id)); err != nil {
+		return err
+	}
+	return r.db.Execute(fmt.Sprintf("DELETE FROM webhook_deliveries WHERE webhook_id = %d", id))
+}
+
+// AddEvent puts an event in the outbox and returns its ID. payload is the
+// JSON body webhooks will receive.
+func (r *WebhookRepository) AddEvent(eventType, payload string) (int64, error) {
+	id := nextID()
+	query := fmt.Sprintf(
+		"INSERT INTO webhook_outbox VALUES (%d, '%s', '%s', %d, 0)",
+		id, escapeString(eventType), escapeString(payload), time.Now().Unix(),
+	)
+	if err := r.db.Execute(query); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (r *WebhookRepository) GetEvent(id int64) (*models.OutboxEvent, error) {
+	row, err := r.db.QueryRow(fmt.Sprintf("SELECT %s FROM webhook_outbox WHERE id = %d", outboxColumns, id))
+	if err != nil {
+		return nil, err
+	}
+	return scanOutboxEvent(row)
+}
+
+// MarkEventDispatched records that every delivery of an outbox event has
+// been queued.
+func (r *WebhookRepository) MarkEventDispatched(id int64, now time.Time) error {
+	return r.db.Execute(fmt.Sprintf("UPDATE webhook_outbox SET dispatched_at = %d WHERE id = %d", now.Unix(), id))
+}
+
+// CreateDelivery records a pending delivery of event to webhookID, due
+// immediately. If the event already has a delivery to webhookID, from a
+// fan-out that was cut short, that one is returned instead.
+func (r *WebhookRepository) CreateDelivery(webhookID int64, event *models.OutboxEvent) (*models.WebhookDelivery, error) {
+	_, rows, err := r.db.Query(fmt.Sprintf(
+		"SELECT %s FROM webhook_deliveries WHERE event_id = %d AND webhook_id = %d",
+		deliveryColumns, event.ID, webhookID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > 0 {
+		return scanDelivery(rows[0])
+	}
+
+	now := time.Unix(time.Now().Unix(), 0)
+	delivery := &models.WebhookDelivery{
+		ID:            nextID(),
+		WebhookID:     webhookID,
+		EventID:       event.ID,
+		EventType:     event.Type,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	query := fmt.Sprintf(
+		"INSERT INTO webhook_deliveries VALUES (%d, %d, %d, '%s', '%s', 0, %d, 0, '', %d, %d)",
+		delivery.ID, webhookID, event.ID, escapeString(event.Type), models.DeliveryPending, now.Unix(), now.Unix(), now.Unix(),
+	)
+	if err := r.db.Execute(query); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// SaveDelivery stores the outcome of an attempt, or a manual retry.
+func (r *WebhookRepository) SaveDelivery(delivery *models.WebhookDelivery) error {
+	delivery.UpdatedAt = time.Unix(time.Now().Unix(), 0)
+	query := fmt.Sprintf(
+		"UPDATE webhook_deliveries SET status = '%s', attempts = %d, next_attempt_at = %d, response_code = %d, last_error = '%s', updated_at = %d WHERE id = %d",
+		escapeString(delivery.Status), delivery.Attempts, delivery.NextAttemptAt.Unix(), delivery.ResponseCode,
+		escapeString(truncateError(delivery.LastError)), delivery.UpdatedAt.Unix(), delivery.ID,
+	)
+	return r.db.Execute(query)
+}
+
+func (r *WebhookRepository) GetDeliveryByID(id int64) (*models.WebhookDelivery, error) {
+	_, rows, err := r.db.Query(fmt.Sprintf("SELECT %s FROM webhook_deliveries WHERE id = %d", deliveryColumns, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, webhook.ErrDeliveryNotFound
+	}
+	return scanDelivery(rows[0])
+}
+
+// GetDeliveries returns a page of the delivery log, newest first, for one
+// webhook or all of them when webhookID is 0, optionally only in status.
+func (r *WebhookRepository) GetDeliveries(webhookID int64, status string, page models.Page) ([]models.WebhookDelivery, error) {
+	query := fmt.Sprintf(
+		"SELECT %s FROM webhook_deliveries%s ORDER BY created_at DESC%s",
+		deliveryColumns, deliveryWhere(webhookID, status), limitClause(page),
+	)
+
+	_, rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(pageRows(rows, page)), nil
+}
+
+// CountDeliveries counts what GetDeliveries pages through. NimbleDB has no
+// COUNT, so the ids are fetched and counted here.
+func (r *WebhookRepository) CountDeliveries(webhookID int64, status string) (int, error) {
+	_, rows, err := r.db.Query("SELECT id FROM webhook_deliveries" + deliveryWhere(webhookID, status))
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), nil
+}
+
+func scanDeliveries(rows [][]interface{}) []models.WebhookDelivery {
+	deliveries := make([]models.WebhookDelivery, 0, len(rows))
+	for _, row := range rows {
+		delivery, err := scanDelivery(row)
+		if err != nil {
+			continue
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries
+}
+
+func deliveryWhere(webhookID int64, status string) string {
+	var conditions []string
+	if webhookID != 0 {
+		conditions = append(conditions, fmt.Sprintf("webhook_id = %d", webhookID))
+	}
+	if status != "" {
+		conditions = append(conditions, fmt.Sprintf("status = '%s'", escapeString(status)))
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+const webhookColumns = "id, url, secret, events, active, created_by, created_at"
+
+func scanWebhook(row []interface{}) (*models.Webhook, error) {
+	if len(row) < 7 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	webhook := &models.Webhook{
+		ID:        row[0].(int64),
+		URL:       row[1].(string),
+		Secret:    row[2].(string),
+		Events:    []string{},
+		Active:    row[4].(int64) == 1,
+		CreatedBy: row[5].(int64),
+		CreatedAt: time.Unix(row[6].(int64), 0),
+	}
+	if events := row[3].(string); events != "" {
+		webhook.Events = strings.Split(events, ",")
+	}
+	return webhook, nil
+}
+
+const outboxColumns = "id, event_type, payload, created_at, dispatched_at"
+
+func scanOutboxEvent(row []interface{}) (*models.OutboxEvent, error) {
+	if len(row) < 5 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	event := &models.OutboxEvent{
+		ID:        row[0].(int64),
+		Type:      row[1].(string),
+		Payload:   row[2].(string),
+		CreatedAt: time.Unix(row[3].(int64), 0),
+	}
+	if dispatchedAt := row[4].(int64); dispatchedAt != 0 {
+		event.DispatchedAt = time.Unix(dispatchedAt, 0)
+	}
+	return event, nil
+}
+
+const deliveryColumns = "id, webhook_id, event_id, event_type, status, attempts, next_attempt_at, response_code, last_error, created_at, updated_at"
+
+func scanDelivery(row []interface{}) (*models.WebhookDelivery, error) {
+	if len(row) < 11 {
+		return nil, fmt.Errorf("invalid row data")
+	}
+
+	return &models.WebhookDelivery{
+		ID:            row[0].(int64),
+		WebhookID:     row[1].(int64),
+		EventID:       row[2].(int64),
+		EventType:     row[3].(string),
+		Status:        row[4].(string),
+		Attempts:      int(row[5].(int64)),
+		NextAttemptAt: time.Unix(row[6].(int64), 0),
+		ResponseCode:  int(row[7].(int64)),
+		LastError:     row[8].(string),
+		CreatedAt:     time.Unix(row[9].(int64), 0),
+		UpdatedAt:     time.Unix(row[10].(int64), 0),
+	}, nil
+}
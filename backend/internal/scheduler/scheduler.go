@@ -0,0 +1,105 @@
+// Package scheduler runs periodic background jobs inside the API process.
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job is one unit of periodic work. The context is cancelled when the
+// scheduler stops.
+type Job func(ctx context.Context) error
+
+type task struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+type Scheduler struct {
+	mu      sync.Mutex
+	tasks   []task
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	running bool
+}
+
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Every registers job to run once per interval. Jobs must be registered
+// before Start.
+func (s *Scheduler) Every(name string, interval time.Duration, job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tasks = append(s.tasks, task{name: name, interval: interval, job: job})
+}
+
+// Start runs every registered job immediately and then on its interval, each
+// in its own goroutine. A run never overlaps the previous run of the same job.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return
+	}
+	s.running = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, t := range s.tasks {
+		s.wg.Add(1)
+		go s.loop(ctx, t)
+	}
+}
+
+// Stop cancels running jobs and waits for them to return or for ctx to
+// expire, whichever comes first.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return nil
+	}
+	s.running = false
+	s.cancel()
+	s.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, t task) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.job(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Scheduled job %s failed: %v", t.name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerRunsJobsUntilStopped(t *testing.T) {
+	s := New()
+
+	var runs atomic.Int32
+	s.Every("count", 10*time.Millisecond, func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+
+	s.Start()
+	time.Sleep(55 * time.Millisecond)
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	got := runs.Load()
+	if got < 3 {
+		t.Fatalf("expected at least 3 runs, got %d", got)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if after := runs.Load(); after != got {
+		t.Fatalf("job ran after Stop: %d runs before, %d after", got, after)
+	}
+}
+
+func TestStopGivesUpAfterContextExpires(t *testing.T) {
+	s := New()
+
+	release := make(chan struct{})
+	s.Every("stuck", time.Hour, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	defer close(release)
+
+	s.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := s.Stop(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -1,9 +1,12 @@
 package server
 
 import (
+	authz "backend/internal/auth"
 	"backend/internal/middleware"
+	"backend/internal/ratelimit"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -21,7 +24,8 @@ func (s *FiberServer) RegisterFiberRoutes() {
 	s.App.Use(cors.New(cors.Config{
 		AllowOrigins:     frontendURL,
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS,PATCH",
-		AllowHeaders:     "Accept,Authorization,Content-Type",
+		AllowHeaders:     "Accept,Authorization,Content-Type,If-Match",
+		ExposeHeaders:    "RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,RateLimit-Policy,Retry-After,ETag",
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -29,20 +33,108 @@ func (s *FiberServer) RegisterFiberRoutes() {
 	s.App.Get("/", s.HelloWorldHandler)
 
 	s.App.Get("/health", s.healthHandler)
+	s.App.Get("/feed.rss", s.feedHandler.GetRSS)
+	s.App.Get("/feed.atom", s.feedHandler.GetAtom)
 	api := s.App.Group("/api")
 
+	authLimiter := middleware.RateLimit(middleware.RateLimitConfig{
+		Name:       "auth",
+		Store:      s.rateLimitStore,
+		PerIP:      ratelimit.Limit{Burst: 20, Per: time.Minute},
+		PerAccount: ratelimit.Limit{Burst: 5, Per: time.Minute},
+	})
+	writeLimiter := middleware.RateLimit(middleware.RateLimitConfig{
+		Name:       "write",
+		Store:      s.rateLimitStore,
+		PerIP:      ratelimit.Limit{Burst: 120, Per: time.Minute},
+		PerAccount: ratelimit.Limit{Burst: 30, Per: time.Minute},
+	})
+
 	auth := api.Group("/auth")
-	auth.Post("/register", s.authHandler.Register)
-	auth.Post("/login", s.authHandler.Login)
-	auth.Get("/me", middleware.AuthMiddleware, s.authHandler.GetMe)
-	posts := api.Group("/posts")
-	posts.Get("/", s.postHandler.GetAllPosts)
-	posts.Get("/my/posts", middleware.AuthMiddleware, s.postHandler.GetMyPosts)
-	posts.Get("/:id", s.postHandler.GetPost)
-	posts.Post("/", middleware.AuthMiddleware, s.postHandler.CreatePost)
-	posts.Put("/:id", middleware.AuthMiddleware, s.postHandler.UpdatePost)
-	posts.Delete("/:id", middleware.AuthMiddleware, s.postHandler.DeletePost)
+	auth.Post("/register", authLimiter, s.authHandler.Register)
+	auth.Post("/login", authLimiter, s.authHandler.Login)
+	auth.Post("/login/2fa", authLimiter, s.authHandler.LoginTwoFactor)
+	auth.Get("/me", s.authMiddleware, middleware.RequireScope(authz.ScopeProfileRead), s.authHandler.GetMe)
+	auth.Post("/change-password", s.authMiddleware, middleware.RequireSession, writeLimiter, s.authHandler.ChangePassword)
+	auth.Get("/login-events", s.authMiddleware, middleware.RequireScope(authz.ScopeProfileRead), s.authHandler.GetLoginEvents)
+	auth.Post("/2fa/setup", s.authMiddleware, middleware.RequireSession, s.authHandler.SetupTwoFactor)
+	auth.Post("/2fa/enable", s.authMiddleware, middleware.RequireSession, s.authHandler.EnableTwoFactor)
+	auth.Post("/2fa/disable", s.authMiddleware, middleware.RequireSession, s.authHandler.DisableTwoFactor)
+	auth.Get("/tokens", s.authMiddleware, middleware.RequireSession, s.accessTokenHandler.GetTokens)
+	auth.Post("/tokens", s.authMiddleware, middleware.RequireSession, s.accessTokenHandler.CreateToken)
+	auth.Delete("/tokens/:id", s.authMiddleware, middleware.RequireSession, s.accessTokenHandler.DeleteToken)
+
+	users := api.Group("/users")
+	users.Get("/me", s.authMiddleware, middleware.RequireScope(authz.ScopeProfileRead), s.authHandler.GetMe)
+	users.Put("/me", s.authMiddleware, middleware.RequireScope(authz.ScopeProfileWrite), writeLimiter, s.userHandler.UpdateMe)
+	users.Delete("/me", s.authMiddleware, middleware.RequireSession, writeLimiter, s.userHandler.DeleteMe)
+	users.Put("/me/avatar", s.authMiddleware, middleware.RequireScope(authz.ScopeProfileWrite), writeLimiter, s.attachmentHandler.UploadAvatar)
+	users.Delete("/me/avatar", s.authMiddleware, middleware.RequireScope(authz.ScopeProfileWrite), writeLimiter, s.attachmentHandler.DeleteAvatar)
+	users.Get("/me/bookmarks", s.authMiddleware, middleware.RequireScope(authz.ScopePostsRead), s.bookmarkHandler.GetMyBookmarks)
+	users.Get("/:id", s.optionalAuth, s.userHandler.GetUser)
+	users.Get("/:id/posts", s.optionalAuth, s.userHandler.GetUserPosts)
+	users.Get("/:id/feed.atom", s.feedHandler.GetUserAtom)
+	users.Put("/:id/follow", s.authMiddleware, middleware.RequireScope(authz.ScopeProfileWrite), writeLimiter, s.followHandler.Follow)
+	users.Delete("/:id/follow", s.authMiddleware, middleware.RequireScope(authz.ScopeProfileWrite), writeLimiter, s.followHandler.Unfollow)
+
+	postsRead := middleware.RequireScope(authz.ScopePostsRead)
+	postsWrite := middleware.RequireScope(authz.ScopePostsWrite)
+
+	api.Get("/feed", s.authMiddleware, postsRead, s.postHandler.GetFeed)
 
+	profileRead := middleware.RequireScope(authz.ScopeProfileRead)
+	profileWrite := middleware.RequireScope(authz.ScopeProfileWrite)
+
+	notifications := api.Group("/notifications")
+	notifications.Get("/", s.authMiddleware, profileRead, s.notificationHandler.GetNotifications)
+	notifications.Post("/read-all", s.authMiddleware, profileWrite, writeLimiter, s.notificationHandler.MarkAllRead)
+	notifications.Get("/preferences", s.authMiddleware, profileRead, s.notificationHandler.GetPreferences)
+	notifications.Put("/preferences", s.authMiddleware, profileWrite, writeLimiter, s.notificationHandler.UpdatePreferences)
+	notifications.Post("/:id/read", s.authMiddleware, profileWrite, writeLimiter, s.notificationHandler.MarkRead)
+
+	webhooks := api.Group("/webhooks", s.authMiddleware, middleware.RequireSession, middleware.RequireAdmin)
+	webhooks.Get("/", s.webhookHandler.GetWebhooks)
+	webhooks.Post("/", writeLimiter, s.webhookHandler.CreateWebhook)
+	webhooks.Get("/dead-letters", s.webhookHandler.GetDeadLetters)
+	webhooks.Post("/deliveries/:deliveryId/retry", writeLimiter, s.webhookHandler.RetryDelivery)
+	webhooks.Get("/:id", s.webhookHandler.GetWebhook)
+	webhooks.Put("/:id", writeLimiter, s.webhookHandler.UpdateWebhook)
+	webhooks.Delete("/:id", writeLimiter, s.webhookHandler.DeleteWebhook)
+	webhooks.Get("/:id/deliveries", s.webhookHandler.GetDeliveries)
+
+	api.Get("/tags", s.tagHandler.GetTags)
+	api.Get("/attachments/:id", s.optionalAuth, s.attachmentHandler.ServeAttachment)
+	api.Get("/attachments/:id/thumbnail", s.optionalAuth, s.attachmentHandler.ServeThumbnail)
+
+	posts := api.Group("/posts")
+	posts.Get("/", s.optionalAuth, s.postHandler.GetAllPosts)
+	posts.Get("/my/posts", s.authMiddleware, postsRead, s.postHandler.GetMyPosts)
+	posts.Get("/trash", s.authMiddleware, postsRead, s.postHandler.GetTrash)
+	posts.Get("/by-slug/:slug", s.optionalAuth, s.postHandler.GetPostBySlug)
+	posts.Get("/stream", s.optionalAuth, s.postHandler.StreamPosts)
+	posts.Get("/stream/ws", s.optionalAuth, s.postHandler.StreamPostsSocket)
+	posts.Get("/:id", s.optionalAuth, s.postHandler.GetPost)
+	posts.Post("/", s.authMiddleware, postsWrite, writeLimiter, s.postHandler.CreatePost)
+	posts.Post("/preview", s.authMiddleware, postsWrite, writeLimiter, s.postHandler.PreviewPost)
+	posts.Put("/:id", s.authMiddleware, postsWrite, writeLimiter, s.postHandler.UpdatePost)
+	posts.Patch("/:id", s.authMiddleware, postsWrite, writeLimiter, s.postHandler.PatchPost)
+	posts.Delete("/:id", s.authMiddleware, postsWrite, writeLimiter, s.postHandler.DeletePost)
+	posts.Post("/:id/restore", s.authMiddleware, postsWrite, writeLimiter, s.postHandler.RestorePost)
+	posts.Put("/:id/reactions", s.authMiddleware, postsWrite, writeLimiter, s.reactionHandler.PutReaction)
+	posts.Delete("/:id/reactions", s.authMiddleware, postsWrite, writeLimiter, s.reactionHandler.DeleteReaction)
+	posts.Put("/:id/bookmark", s.authMiddleware, postsWrite, writeLimiter, s.bookmarkHandler.PutBookmark)
+	posts.Delete("/:id/bookmark", s.authMiddleware, postsWrite, writeLimiter, s.bookmarkHandler.DeleteBookmark)
+	posts.Get("/:id/revisions", s.authMiddleware, postsRead, s.revisionHandler.GetRevisions)
+	posts.Get("/:id/revisions/diff", s.authMiddleware, postsRead, s.revisionHandler.DiffRevisions)
+	posts.Get("/:id/revisions/:rev", s.authMiddleware, postsRead, s.revisionHandler.GetRevision)
+	posts.Post("/:id/revisions/:rev/restore", s.authMiddleware, postsWrite, writeLimiter, s.revisionHandler.RestoreRevision)
+	posts.Get("/:id/comments", s.optionalAuth, s.commentHandler.GetComments)
+	posts.Post("/:id/comments", s.authMiddleware, postsWrite, writeLimiter, s.commentHandler.CreateComment)
+	posts.Put("/:id/comments/:commentId", s.authMiddleware, postsWrite, writeLimiter, s.commentHandler.UpdateComment)
+	posts.Delete("/:id/comments/:commentId", s.authMiddleware, postsWrite, writeLimiter, s.commentHandler.DeleteComment)
+	posts.Get("/:id/attachments", s.optionalAuth, s.attachmentHandler.GetAttachments)
+	posts.Post("/:id/attachments", s.authMiddleware, postsWrite, writeLimiter, s.attachmentHandler.UploadAttachment)
+	posts.Delete("/:id/attachments/:attachmentId", s.authMiddleware, postsWrite, writeLimiter, s.attachmentHandler.DeleteAttachment)
 }
 
 func (s *FiberServer) HelloWorldHandler(c *fiber.Ctx) error {
@@ -3,23 +3,68 @@ package server
 import (
 	"backend/internal/database"
 	"backend/internal/handlers"
+	"backend/internal/jobs"
+	"backend/internal/middleware"
+	"backend/internal/notify"
+	"backend/internal/pubsub"
+	"backend/internal/ratelimit"
 	"backend/internal/repository"
+	"backend/internal/scheduler"
+	"backend/internal/storage"
+	"backend/internal/webhook"
+	"context"
 	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type FiberServer struct {
 	*fiber.App
-	db          database.Service
-	authHandler *handlers.AuthHandler
-	postHandler *handlers.PostHandler
+	db                  database.Service
+	authHandler         *handlers.AuthHandler
+	postHandler         *handlers.PostHandler
+	userHandler         *handlers.UserHandler
+	accessTokenHandler  *handlers.AccessTokenHandler
+	commentHandler      *handlers.CommentHandler
+	reactionHandler     *handlers.ReactionHandler
+	tagHandler          *handlers.TagHandler
+	revisionHandler     *handlers.RevisionHandler
+	attachmentHandler   *handlers.AttachmentHandler
+	followHandler       *handlers.FollowHandler
+	bookmarkHandler     *handlers.BookmarkHandler
+	notificationHandler *handlers.NotificationHandler
+	feedHandler         *handlers.FeedHandler
+	webhookHandler      *handlers.WebhookHandler
+	postEvents          *pubsub.Hub[handlers.PostEvent]
+	authMiddleware      fiber.Handler
+	optionalAuth        fiber.Handler
+	rateLimitStore      ratelimit.Store
+	scheduler           *scheduler.Scheduler
+	jobs                *jobs.Queue
 }
 
 func New(dbAddr string) *FiberServer {
 	db := database.New(dbAddr)
 	userRepo := repository.NewUserRepository(db)
 	postRepo := repository.NewPostRepository(db)
+	loginEventRepo := repository.NewLoginEventRepository(db)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepository(db)
+	accessTokenRepo := repository.NewAccessTokenRepository(db)
+	commentRepo := repository.NewCommentRepository(db)
+	reactionRepo := repository.NewReactionRepository(db)
+	tagRepo := repository.NewTagRepository(db)
+	revisionRepo := repository.NewRevisionRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	followRepo := repository.NewFollowRepository(db)
+	bookmarkRepo := repository.NewBookmarkRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	jobRepo := repository.NewJobRepository(db)
 	if err := userRepo.InitTable(); err != nil {
 		log.Printf("Warning: Failed to initialize users table: %v", err)
 	} else {
@@ -30,16 +75,295 @@ func New(dbAddr string) *FiberServer {
 	} else {
 		log.Println("Posts table ready")
 	}
+	if err := postRepo.InitSlugTable(); err != nil {
+		log.Printf("Warning: Failed to initialize post_slugs table: %v", err)
+	} else {
+		log.Println("Post slugs table ready")
+	}
+	if err := loginEventRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize login_events table: %v", err)
+	} else {
+		log.Println("Login events table ready")
+	}
+	if err := recoveryCodeRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize recovery_codes table: %v", err)
+	} else {
+		log.Println("Recovery codes table ready")
+	}
+	if err := accessTokenRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize access_tokens table: %v", err)
+	} else {
+		log.Println("Access tokens table ready")
+	}
+	if err := commentRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize comments table: %v", err)
+	} else {
+		log.Println("Comments table ready")
+	}
+	if err := reactionRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize reactions table: %v", err)
+	} else {
+		log.Println("Reactions table ready")
+	}
+	if err := tagRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize post_tags table: %v", err)
+	} else {
+		log.Println("Post tags table ready")
+	}
+	if err := revisionRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize post_revisions table: %v", err)
+	} else {
+		log.Println("Post revisions table ready")
+	}
+	if err := attachmentRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize attachments table: %v", err)
+	} else {
+		log.Println("Attachments table ready")
+	}
+	if err := followRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize follows table: %v", err)
+	} else {
+		log.Println("Follows table ready")
+	}
+	if err := bookmarkRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize bookmarks table: %v", err)
+	} else {
+		log.Println("Bookmarks table ready")
+	}
+	if err := notificationRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize notifications tables: %v", err)
+	} else {
+		log.Println("Notifications tables ready")
+	}
+	if err := webhookRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize webhook tables: %v", err)
+	} else {
+		log.Println("Webhook tables ready")
+	}
+	if err := jobRepo.InitTable(); err != nil {
+		log.Printf("Warning: Failed to initialize jobs table: %v", err)
+	} else {
+		log.Println("Jobs table ready")
+	}
+
+	trashRetention := defaultTrashRetention
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days > 0 {
+		trashRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	maxUploadBytes := int64(defaultMaxUploadMB) << 20
+	if mb, err := strconv.Atoi(os.Getenv("MAX_UPLOAD_MB")); err == nil && mb > 0 {
+		maxUploadBytes = int64(mb) << 20
+	}
+
+	blobStore := newBlobStore()
+	notifier := notify.New(notificationRepo)
+	postEvents := pubsub.New[handlers.PostEvent]()
+
+	jobWorkers, _ := strconv.Atoi(os.Getenv("JOB_WORKERS"))
+	queue := jobs.New(jobRepo, jobs.Config{Concurrency: jobWorkers})
+	dispatcher := webhook.NewDispatcher(webhookRepo, queue, &http.Client{Timeout: webhookTimeout})
+	announcer := handlers.NewPostEvents(postEvents, dispatcher)
+	postHandler := handlers.NewPostHandler(postRepo, reactionRepo, tagRepo, revisionRepo, bookmarkRepo, announcer, queue, trashRetention)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentRepo, postRepo, userRepo, blobStore, queue, maxUploadBytes, os.Getenv("PUBLIC_API_URL"))
+	queue.Handle(handlers.ThumbnailJob, attachmentHandler.MakeThumbnail)
+	queue.Handle(handlers.PurgeTrashJob, postHandler.PurgeTrash)
+	queue.Handle(webhook.FanOutJob, dispatcher.FanOut)
+	queue.Handle(webhook.DeliverJob, dispatcher.Deliver)
+	// Deleting a post queues its purge; one more run at startup catches
+	// posts whose job was never queued.
+	if err := queue.Enqueue(handlers.PurgeTrashJob, nil); err != nil {
+		log.Printf("Warning: Failed to queue trash purge: %v", err)
+	}
+
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if os.Getenv("RATE_LIMIT_STORE") == "nimbledb" {
+		nimbleStore := ratelimit.NewNimbleStore(db)
+		if err := nimbleStore.InitTable(); err != nil {
+			log.Printf("Warning: Failed to initialize rate_limits table, using in-memory rate limits: %v", err)
+		} else {
+			log.Println("Rate limits table ready")
+			rateLimitStore = nimbleStore
+		}
+	}
+
+	config := fiber.Config{
+		ServerHeader: "backend",
+		AppName:      "backend",
+		// Leave room for the multipart framing around an upload.
+		BodyLimit: int(maxUploadBytes) + 1<<20,
+	}
+	trustProxies(&config)
 
 	server := &FiberServer{
-		App: fiber.New(fiber.Config{
-			ServerHeader: "backend",
-			AppName:      "backend",
-		}),
-		db:          db,
-		authHandler: handlers.NewAuthHandler(userRepo),
-		postHandler: handlers.NewPostHandler(postRepo),
+		App:                 fiber.New(config),
+		db:                  db,
+		authHandler:         handlers.NewAuthHandler(userRepo, loginEventRepo, recoveryCodeRepo, dispatcher),
+		postHandler:         postHandler,
+		userHandler:         handlers.NewUserHandler(userRepo, postRepo, commentRepo, reactionRepo, followRepo, bookmarkRepo, notificationRepo, loginEventRepo, recoveryCodeRepo, accessTokenRepo, dispatcher),
+		accessTokenHandler:  handlers.NewAccessTokenHandler(accessTokenRepo),
+		commentHandler:      handlers.NewCommentHandler(commentRepo, postRepo, notifier),
+		reactionHandler:     handlers.NewReactionHandler(reactionRepo, postRepo, bookmarkRepo, notifier),
+		tagHandler:          handlers.NewTagHandler(tagRepo),
+		revisionHandler:     handlers.NewRevisionHandler(revisionRepo, postRepo, announcer),
+		followHandler:       handlers.NewFollowHandler(followRepo, userRepo, notifier),
+		bookmarkHandler:     handlers.NewBookmarkHandler(bookmarkRepo, postRepo, reactionRepo),
+		notificationHandler: handlers.NewNotificationHandler(notificationRepo),
+		feedHandler:         handlers.NewFeedHandler(postRepo, userRepo, os.Getenv("FRONTEND_URL"), os.Getenv("PUBLIC_API_URL")),
+		webhookHandler:      handlers.NewWebhookHandler(webhookRepo, dispatcher),
+		attachmentHandler:   attachmentHandler,
+		authMiddleware:      middleware.NewAuthMiddleware(accessTokenRepo, userRepo),
+		optionalAuth:        middleware.NewOptionalAuthMiddleware(accessTokenRepo, userRepo),
+		postEvents:          postEvents,
+		rateLimitStore:      rateLimitStore,
+		scheduler:           scheduler.New(),
+		jobs:                queue,
 	}
 
+	server.scheduler.Every("publish-scheduled-posts", publishInterval, func(ctx context.Context) error {
+		published, err := postRepo.PublishDuePosts(time.Now())
+		for _, id := range published {
+			if post, err := postRepo.GetPostByID(id); err == nil {
+				announcer.Announce(handlers.PostEventUpdated, post, nil)
+			}
+		}
+		return err
+	})
+	server.scheduler.Every("sweep-orphaned-attachments", purgeInterval, func(ctx context.Context) error {
+		return sweepAttachments(ctx, attachmentRepo, blobStore, time.Now().Add(-purgeInterval))
+	})
+
 	return server
 }
+
+// trustProxies makes c.IP() the client's address when the API runs behind
+// a reverse proxy. Requests from the comma-separated addresses or CIDR
+// ranges in TRUSTED_PROXIES take the client IP from PROXY_HEADER
+// (X-Forwarded-For by default); the proxy must set that header rather than
+// pass on what the client sent. Otherwise every client appears with the
+// proxy's address and they all share one rate limit.
+func trustProxies(config *fiber.Config) {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	if len(proxies) == 0 {
+		return
+	}
+
+	config.EnableTrustedProxyCheck = true
+	config.TrustedProxies = proxies
+	config.ProxyHeader = fiber.HeaderXForwardedFor
+	if header := os.Getenv("PROXY_HEADER"); header != "" {
+		config.ProxyHeader = header
+	}
+	// X-Forwarded-For may list several addresses; the first valid one is
+	// used.
+	config.EnableIPValidation = true
+}
+
+// newBlobStore picks where uploads are kept from STORAGE_BACKEND: "local"
+// (the default) writes under UPLOAD_DIR, "s3" uses an S3-compatible bucket.
+// A misconfigured S3 store falls back to local storage.
+func newBlobStore() storage.BlobStore {
+	if os.Getenv("STORAGE_BACKEND") == "s3" {
+		store, err := storage.NewS3Store(storage.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+		if err == nil {
+			log.Println("Storing uploads in S3")
+			return store
+		}
+		log.Printf("Warning: Failed to configure S3 storage, storing uploads locally: %v", err)
+	}
+
+	dir := os.Getenv("UPLOAD_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	store, err := storage.NewLocalStore(dir)
+	if err != nil {
+		log.Fatalf("Failed to create upload directory %s: %v", dir, err)
+	}
+	return store
+}
+
+// sweepAttachments deletes the files of purged posts and deleted users that
+// were uploaded before cutoff. Attachment rows outlive their owners because
+// neither purging posts nor deleting accounts has access to the blob store.
+func sweepAttachments(ctx context.Context, attachmentRepo *repository.AttachmentRepository, store storage.BlobStore, cutoff time.Time) error {
+	orphans, err := attachmentRepo.GetOrphanedAttachments(cutoff)
+	if err != nil {
+		return err
+	}
+
+	for _, attachment := range orphans {
+		for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+			if key == "" {
+				continue
+			}
+			if err := store.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+		if err := attachmentRepo.DeleteAttachment(attachment.ID); err != nil {
+			return err
+		}
+	}
+
+	if len(orphans) > 0 {
+		log.Printf("Removed %d orphaned attachments", len(orphans))
+	}
+	return nil
+}
+
+const (
+	// publishInterval is how often scheduled posts are checked, and so
+	// roughly how late past their publish_at they may go live.
+	publishInterval = 30 * time.Second
+	purgeInterval   = time.Hour
+
+	webhookTimeout = 10 * time.Second
+
+	// defaultTrashRetention is how long deleted posts stay restorable unless
+	// TRASH_RETENTION_DAYS says otherwise.
+	defaultTrashRetention = 30 * 24 * time.Hour
+
+	// defaultMaxUploadMB caps attachment uploads unless MAX_UPLOAD_MB says
+	// otherwise.
+	defaultMaxUploadMB = 10
+)
+
+// StartBackgroundJobs starts the periodic jobs and the job queue's workers
+// that run alongside the HTTP server.
+func (s *FiberServer) StartBackgroundJobs() {
+	s.scheduler.Start()
+	s.jobs.Start()
+}
+
+// StopBackgroundJobs stops the periodic jobs, waiting for running ones to
+// finish until ctx expires.
+func (s *FiberServer) StopBackgroundJobs(ctx context.Context) error {
+	return s.scheduler.Stop(ctx)
+}
+
+// DrainJobQueue stops the job queue's workers from taking new jobs and
+// waits for running ones until ctx expires. Jobs still running then are put
+// back in the queue.
+func (s *FiberServer) DrainJobQueue(ctx context.Context) error {
+	return s.jobs.Drain(ctx)
+}
+
+// ShutdownWithContext ends the open post streams before shutting the HTTP
+// server down, which would otherwise wait on their connections until ctx
+// expires.
+func (s *FiberServer) ShutdownWithContext(ctx context.Context) error {
+	s.postEvents.Close()
+	return s.App.ShutdownWithContext(ctx)
+}
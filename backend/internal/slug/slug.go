@@ -0,0 +1,114 @@
+// Package slug turns post titles into readable URL path segments.
+package slug
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength bounds a slug, including any collision suffix.
+const MaxLength = 80
+
+// fallback is used for titles with nothing that can be transliterated.
+const fallback = "post"
+
+// transliterations covers letters that do not decompose into an ASCII base
+// letter plus accents, so stripping combining marks alone would drop them.
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ı': "i",
+	'&': " and ",
+
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "iu",
+	'я': "ia", 'є': "ie", 'і': "i", 'ї': "i", 'ґ': "g",
+
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o",
+}
+
+// Make builds a slug from title: lowercase ASCII letters and digits separated
+// by single dashes. Accents are stripped, common non-Latin letters are
+// transliterated and anything else is dropped.
+func Make(title string) string {
+	decomposed, _, err := transform.String(
+		transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn))),
+		strings.ToLower(title),
+	)
+	if err != nil {
+		decomposed = strings.ToLower(title)
+	}
+
+	var b strings.Builder
+	pendingDash := false
+	write := func(r rune) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if pendingDash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingDash = false
+			b.WriteRune(r)
+			return
+		}
+		pendingDash = true
+	}
+
+	for _, r := range decomposed {
+		if replacement, ok := transliterations[r]; ok {
+			for _, rr := range replacement {
+				write(rr)
+			}
+			continue
+		}
+		write(r)
+	}
+
+	return truncate(b.String(), MaxLength)
+}
+
+// WithSuffix appends a collision counter to base, shortening base so the
+// result still fits in MaxLength.
+func WithSuffix(base string, n int) string {
+	suffix := "-" + strconv.Itoa(n)
+	return truncate(base, MaxLength-len(suffix)) + suffix
+}
+
+// HasBase reports whether s is base itself or base with a collision suffix,
+// meaning a post titled to give base can keep s.
+func HasBase(s, base string) bool {
+	if s == base {
+		return true
+	}
+	i := strings.LastIndexByte(s, '-')
+	if i < 0 {
+		return false
+	}
+	n, err := strconv.Atoi(s[i+1:])
+	return err == nil && n > 1 && WithSuffix(base, n) == s
+}
+
+// truncate shortens s to at most max bytes, preferring to cut at a dash.
+// Slugs are ASCII, so cutting at a byte offset is safe.
+func truncate(s string, max int) string {
+	if len(s) > max {
+		s = s[:max]
+		if i := strings.LastIndexByte(s, '-'); i > max/2 {
+			s = s[:i]
+		}
+	}
+	s = strings.Trim(s, "-")
+	if s == "" {
+		return fallback
+	}
+	return s
+}
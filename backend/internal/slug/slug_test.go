@@ -0,0 +1,69 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Go 1.25 release notes  ", "go-1-25-release-notes"},
+		{"Crème brûlée à la carte", "creme-brulee-a-la-carte"},
+		{"Straße & Ærø", "strasse-and-aero"},
+		{"Привет мир", "privet-mir"},
+		{"Ελληνικά", "ellinika"},
+		{"ｆｕｌｌｗｉｄｔｈ", "fullwidth"},
+		{"---", "post"},
+		{"日本語", "post"},
+	}
+	for _, tt := range tests {
+		if got := Make(tt.title); got != tt.want {
+			t.Errorf("Make(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestMakeTruncates(t *testing.T) {
+	title := strings.Repeat("word ", 40)
+	got := Make(title)
+	if len(got) > MaxLength {
+		t.Fatalf("Make() length = %d, want at most %d", len(got), MaxLength)
+	}
+	if strings.HasSuffix(got, "-") || strings.HasSuffix(got, "-wor") {
+		t.Errorf("Make() = %q, want it cut at a word boundary", got)
+	}
+}
+
+func TestWithSuffix(t *testing.T) {
+	if got := WithSuffix("hello", 2); got != "hello-2" {
+		t.Errorf("WithSuffix() = %q, want %q", got, "hello-2")
+	}
+
+	long := Make(strings.Repeat("a", 200))
+	if got := WithSuffix(long, 12); len(got) > MaxLength || !strings.HasSuffix(got, "-12") {
+		t.Errorf("WithSuffix() = %q, want at most %d bytes ending in -12", got, MaxLength)
+	}
+}
+
+func TestHasBase(t *testing.T) {
+	tests := []struct {
+		s, base string
+		want    bool
+	}{
+		{"hello", "hello", true},
+		{"hello-3", "hello", true},
+		{"hello-world", "hello", false},
+		{"hello-", "hello", false},
+		{"hello", "hello-2", false},
+		{WithSuffix(strings.Repeat("a", MaxLength), 7), strings.Repeat("a", MaxLength), true},
+	}
+	for _, tt := range tests {
+		if got := HasBase(tt.s, tt.base); got != tt.want {
+			t.Errorf("HasBase(%q, %q) = %v, want %v", tt.s, tt.base, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(ctx, "attachments/1/a.txt", "text/plain", []byte("hello")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	rc, err := store.Get(ctx, "attachments/1/a.txt")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "hello" {
+		t.Errorf("Get() = %q, want %q", data, "hello")
+	}
+
+	if err := store.Delete(ctx, "attachments/1/a.txt"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "attachments/1/a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "attachments/1/a.txt"); err != nil {
+		t.Errorf("Delete() of a missing blob error = %v, want nil", err)
+	}
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../secret", "a/../../b", `a\b`, "a//b"} {
+		if err := store.Put(context.Background(), key, "text/plain", []byte("x")); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+	}
+}
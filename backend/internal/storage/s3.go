@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config points an S3Store at a bucket. Endpoint is the base URL of any
+// S3-compatible service, e.g. https://s3.us-east-1.amazonaws.com or a MinIO
+// server; buckets are addressed path-style.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// S3Store keeps blobs in an S3-compatible bucket, signing requests with AWS
+// Signature Version 4.
+type S3Store struct {
+	cfg    S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 storage needs an endpoint, bucket and credentials")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+
+	return &S3Store{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key, contentType string, data []byte) error {
+	req, err := s.request(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, s3Error(resp)
+	}
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return s3Error(resp)
+	}
+}
+
+func (s *S3Store) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	target := s.cfg.Endpoint + "/" + url.PathEscape(s.cfg.Bucket) + "/" + strings.Join(segments, "/")
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	return http.NewRequestWithContext(ctx, method, target, reader)
+}
+
+func (s *S3Store) do(req *http.Request, body []byte) (*http.Response, error) {
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signV4(req, s.cfg.AccessKeyID, s.cfg.SecretAccessKey, s.cfg.Region, "s3", payloadHash, s.now())
+	return s.client.Do(req)
+}
+
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header to req. The
+// host header and every X-Amz-* and Content-Type header already on req are
+// signed.
+func signV4(req *http.Request, accessKeyID, secretAccessKey, region, service, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func canonicalQuery(values url.Values) string {
+	pairs := make([]string, 0, len(values))
+	for name, vs := range values {
+		for _, v := range vs {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything except unreserved characters, as
+// SigV4 requires; url.QueryEscape would turn spaces into '+'.
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestSignV4 checks the signer against the get-vanilla case of the AWS
+// Signature Version 4 test suite.
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	signV4(req, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", sha256Hex(nil), now)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization = %q\nwant %q", got, want)
+	}
+}
+
+// fakeS3 is a minimal stand-in for an S3 bucket. It checks each request is
+// signed for the expected bucket and that the payload hash matches the body.
+type fakeS3 struct {
+	t      *testing.T
+	mu     sync.Mutex
+	bucket string
+	blobs  map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=key-id/") || !strings.Contains(auth, "/eu-west-1/s3/aws4_request") {
+		f.t.Errorf("%s %s: unexpected Authorization %q", r.Method, r.URL.Path, auth)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != sha256Hex(body) {
+		f.t.Errorf("%s %s: payload hash %q does not match body", r.Method, r.URL.Path, got)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		f.blobs[key] = body
+	case http.MethodGet:
+		data, ok := f.blobs[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.blobs, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{t: t, bucket: "uploads", blobs: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:        server.URL + "/",
+		Region:          "eu-west-1",
+		Bucket:          "uploads",
+		AccessKeyID:     "key-id",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "attachments/7/photo.jpg", "image/jpeg", []byte("jpeg bytes")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if got := string(fake.blobs["attachments/7/photo.jpg"]); got != "jpeg bytes" {
+		t.Errorf("stored blob = %q, want %q", got, "jpeg bytes")
+	}
+
+	rc, err := store.Get(ctx, "attachments/7/photo.jpg")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "jpeg bytes" {
+		t.Errorf("Get() = %q, want %q", data, "jpeg bytes")
+	}
+
+	if err := store.Delete(ctx, "attachments/7/photo.jpg"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "attachments/7/photo.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+}
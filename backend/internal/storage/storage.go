@@ -0,0 +1,38 @@
+// Package storage keeps uploaded files in a blob store. Blobs are immutable:
+// a key is written once and later deleted, never overwritten with other
+// content, which lets readers cache them freely.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores opaque blobs under slash-separated keys such as
+// "attachments/123/abcd.png".
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Get returns the blob's content, or ErrNotFound. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// validateKey rejects keys that could escape the store's root: absolute
+// paths, empty or dot segments and backslashes.
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid blob key %q", key)
+		}
+	}
+	return nil
+}
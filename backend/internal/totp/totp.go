@@ -0,0 +1,110 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits = 6
+	Period = 30 * time.Second
+
+	// Skew is the number of periods before and after the current one that
+	// are still accepted, to tolerate clock drift on the user's device.
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(Digits))
+	params.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(Step(t))), nil
+}
+
+// Step returns the time step t falls in; each step has its own code.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// Match returns the time step whose code is code, trying the Skew steps on
+// either side of t's. A code stays valid for the whole window, so callers
+// should remember the last step they accepted and reject codes from it or
+// before it; otherwise an observed code can be replayed.
+func Match(secret, code string, t time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	now := Step(t)
+	for step := now - Skew; step <= now+Skew; step++ {
+		expected := hotp(key, uint64(step))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret: %w", err)
+	}
+	return key, nil
+}
+
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod)
+}
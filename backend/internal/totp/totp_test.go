@@ -0,0 +1,50 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// Secret and expected values from RFC 6238 Appendix B, truncated to six digits.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("at %d: expected %s; got %s", tt.unix, tt.code, code)
+		}
+	}
+}
+
+func TestMatchAllowsSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	step, ok := Match(rfcSecret, "081804", now.Add(Period))
+	if !ok {
+		t.Error("expected code from the previous period to be accepted")
+	}
+	if step != Step(now) {
+		t.Errorf("expected step %d; got %d", Step(now), step)
+	}
+	if _, ok := Match(rfcSecret, "081804", now.Add(3*Period)); ok {
+		t.Error("expected code from three periods ago to be rejected")
+	}
+	if _, ok := Match(rfcSecret, "12345", now); ok {
+		t.Error("expected a code with the wrong length to be rejected")
+	}
+}
@@ -0,0 +1,290 @@
+// Package webhook delivers events to subscribed HTTP endpoints.
+//
+// Events are written to an outbox when the change they describe is saved,
+// and a job on the job queue fans each one out into a delivery per
+// subscribed webhook. Every delivery is sent by a job of its own, signed
+// with the webhook's secret. Failed deliveries are queued again with
+// exponential backoff until MaxAttempts, after which they are dead and wait
+// on the dead-letter list for a manual retry.
+package webhook
+
+import (
+	"backend/internal/jobs"
+	"backend/internal/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is dead.
+	MaxAttempts = 8
+
+	// MaxPayloadLength is the size of the outbox's payload column. NimbleDB
+	// cannot store a row larger than a page, so events are kept small
+	// rather than the column made larger.
+	MaxPayloadLength = 2000
+
+	firstRetry = 30 * time.Second
+	maxRetry   = 6 * time.Hour
+)
+
+// FanOutJob and DeliverJob are the kinds of job the dispatcher handles.
+const (
+	FanOutJob  = "webhook.fanout"
+	DeliverJob = "webhook.deliver"
+)
+
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderEventID   = "X-Webhook-Event-Id"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// ErrDeliveryNotFound is returned by Store.GetDeliveryByID for a delivery
+// that does not exist, such as one removed along with its webhook.
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+// Store is the storage the dispatcher needs. It is satisfied by
+// repository.WebhookRepository.
+type Store interface {
+	GetWebhooks() ([]models.Webhook, error)
+	GetWebhookByID(id int64) (*models.Webhook, error)
+	AddEvent(eventType, payload string) (int64, error)
+	GetEvent(id int64) (*models.OutboxEvent, error)
+	MarkEventDispatched(id int64, now time.Time) error
+	CreateDelivery(webhookID int64, event *models.OutboxEvent) (*models.WebhookDelivery, error)
+	GetDeliveryByID(id int64) (*models.WebhookDelivery, error)
+	SaveDelivery(delivery *models.WebhookDelivery) error
+}
+
+// Queue is the job queue the dispatcher's work runs on. It is satisfied by
+// jobs.Queue, whose workers should run FanOut and Deliver.
+type Queue interface {
+	Enqueue(kind string, payload any) error
+	EnqueueAt(kind string, payload any, runAt time.Time) error
+}
+
+type eventJob struct {
+	EventID int64 `json:"event_id"`
+}
+
+type deliveryJob struct {
+	DeliveryID int64 `json:"delivery_id"`
+}
+
+type Dispatcher struct {
+	store  Store
+	queue  Queue
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewDispatcher returns a dispatcher sending with client. The client's
+// timeout bounds each attempt, and should be set.
+func NewDispatcher(store Store, queue Queue, client *http.Client) *Dispatcher {
+	return &Dispatcher{store: store, queue: queue, client: client, now: time.Now}
+}
+
+// Publish puts an event in the outbox and queues it to be fanned out.
+// payload is the JSON body webhooks will receive.
+func (d *Dispatcher) Publish(eventType, payload string) error {
+	if len(payload) > MaxPayloadLength {
+		return fmt.Errorf("payload of %d bytes exceeds %d", len(payload), MaxPayloadLength)
+	}
+	id, err := d.store.AddEvent(eventType, payload)
+	if err != nil {
+		return err
+	}
+	return d.queue.Enqueue(FanOutJob, eventJob{EventID: id})
+}
+
+// FanOut is the handler of FanOutJob. It creates a delivery of the event
+// for every active webhook subscribed to its type, and queues each one.
+// The event is marked dispatched once all of them are queued; until then a
+// failure is returned so the job runs again, and the rerun reuses the
+// deliveries already made.
+func (d *Dispatcher) FanOut(ctx context.Context, payload []byte) error {
+	var job eventJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	event, err := d.store.GetEvent(job.EventID)
+	if err != nil {
+		return err
+	}
+	if !event.DispatchedAt.IsZero() {
+		return nil
+	}
+	webhooks, err := d.store.GetWebhooks()
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Active || !webhook.Wants(event.Type) {
+			continue
+		}
+		delivery, err := d.store.CreateDelivery(webhook.ID, event)
+		if err != nil {
+			return fmt.Errorf("creating delivery of event %d to webhook %d: %w", event.ID, webhook.ID, err)
+		}
+		// A delivery that has been attempted already had its job run. One
+		// that has not may be queued twice by a rerun, which Deliver
+		// tolerates by checking its status first.
+		if delivery.Status != models.DeliveryPending || delivery.Attempts > 0 {
+			continue
+		}
+		if err := d.queue.Enqueue(DeliverJob, deliveryJob{DeliveryID: delivery.ID}); err != nil {
+			return fmt.Errorf("queueing delivery %d: %w", delivery.ID, err)
+		}
+	}
+
+	return d.store.MarkEventDispatched(event.ID, d.now())
+}
+
+// Retry queues a delivery to be sent again straight away, with a fresh set
+// of attempts.
+func (d *Dispatcher) Retry(delivery *models.WebhookDelivery) error {
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Unix(d.now().Unix(), 0)
+	if err := d.store.SaveDelivery(delivery); err != nil {
+		return err
+	}
+	return d.queue.Enqueue(DeliverJob, deliveryJob{DeliveryID: delivery.ID})
+}
+
+// Deliver is the handler of DeliverJob. It makes one attempt at sending a
+// delivery and, if that fails, queues the next. Deliveries that were
+// removed, already sent or are not due yet, because a manual retry
+// rescheduled them, are skipped.
+func (d *Dispatcher) Deliver(ctx context.Context, payload []byte) error {
+	var job deliveryJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	delivery, err := d.store.GetDeliveryByID(job.DeliveryID)
+	if errors.Is(err, ErrDeliveryNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if delivery.Status != models.DeliveryPending || delivery.NextAttemptAt.After(d.now()) {
+		return nil
+	}
+
+	d.attempt(ctx, delivery)
+	if delivery.Status == models.DeliveryPending {
+		// Queued before saving: if queueing fails the job is retried and
+		// finds the delivery still due, rather than saved with a next
+		// attempt that no job will make.
+		if err := d.queue.EnqueueAt(DeliverJob, job, delivery.NextAttemptAt); err != nil {
+			return err
+		}
+	}
+	if err := d.store.SaveDelivery(delivery); err != nil {
+		log.Printf("Failed to save webhook delivery %d: %v", delivery.ID, err)
+	}
+	return nil
+}
+
+// attempt sends delivery once and records the outcome on it.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) {
+	webhook, err := d.store.GetWebhookByID(delivery.WebhookID)
+	if err != nil {
+		d.fail(delivery, 0, "webhook not found", true)
+		return
+	}
+	if !webhook.Active {
+		d.fail(delivery, 0, "webhook is disabled", true)
+		return
+	}
+
+	event, err := d.store.GetEvent(delivery.EventID)
+	if err != nil {
+		d.fail(delivery, 0, "event not found", true)
+		return
+	}
+
+	delivery.Attempts++
+	code, err := d.send(ctx, webhook, delivery, event)
+	switch {
+	case err != nil:
+		d.fail(delivery, code, err.Error(), false)
+	case code < 200 || code > 299:
+		d.fail(delivery, code, fmt.Sprintf("unexpected status %d", code), false)
+	default:
+		delivery.Status = models.DeliverySucceeded
+		delivery.ResponseCode = code
+		delivery.LastError = ""
+	}
+}
+
+func (d *Dispatcher) fail(delivery *models.WebhookDelivery, code int, reason string, dead bool) {
+	delivery.ResponseCode = code
+	delivery.LastError = reason
+
+	if dead || delivery.Attempts >= MaxAttempts {
+		delivery.Status = models.DeliveryDead
+		return
+	}
+	delivery.NextAttemptAt = time.Unix(d.now().Add(Backoff(delivery.Attempts)).Unix(), 0)
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery, event *models.OutboxEvent) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(event.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nimbledb-demo-webhooks")
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderEventID, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, d.now(), []byte(event.Payload)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Draining a little lets the connection be reused; whatever else the
+	// receiver has to say is not needed.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	return resp.StatusCode, nil
+}
+
+// Backoff is how long to wait after the given failed attempt, counting from
+// 1: 30s, doubling each time, at most six hours.
+func Backoff(attempt int) time.Duration {
+	return jobs.Backoff(firstRetry, maxRetry, attempt)
+}
+
+// Sign returns the signature header for body sent at t: "t=<unix>,v1=<hex>",
+// where v1 is the HMAC-SHA256 of "<unix>.<body>" keyed with secret.
+// Receivers should recompute it and reject old timestamps to stop replays.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,403 @@
+package webhook
+
+import (
+	"backend/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	webhooks   []models.Webhook
+	events     []models.OutboxEvent
+	deliveries []models.WebhookDelivery
+}
+
+func (m *memoryStore) GetWebhooks() ([]models.Webhook, error) {
+	return m.webhooks, nil
+}
+
+func (m *memoryStore) GetWebhookByID(id int64) (*models.Webhook, error) {
+	for i := range m.webhooks {
+		if m.webhooks[i].ID == id {
+			return &m.webhooks[i], nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (m *memoryStore) AddEvent(eventType, payload string) (int64, error) {
+	id := int64(len(m.events) + 1)
+	m.events = append(m.events, models.OutboxEvent{ID: id, Type: eventType, Payload: payload})
+	return id, nil
+}
+
+func (m *memoryStore) GetEvent(id int64) (*models.OutboxEvent, error) {
+	for i := range m.events {
+		if m.events[i].ID == id {
+			return &m.events[i], nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (m *memoryStore) MarkEventDispatched(id int64, now time.Time) error {
+	for i := range m.events {
+		if m.events[i].ID == id {
+			m.events[i].DispatchedAt = now
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) CreateDelivery(webhookID int64, event *models.OutboxEvent) (*models.WebhookDelivery, error) {
+	for _, d := range m.deliveries {
+		if d.WebhookID == webhookID && d.EventID == event.ID {
+			return &d, nil
+		}
+	}
+	delivery := models.WebhookDelivery{
+		ID:        int64(len(m.deliveries) + 1),
+		WebhookID: webhookID,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Status:    models.DeliveryPending,
+	}
+	m.deliveries = append(m.deliveries, delivery)
+	return &delivery, nil
+}
+
+func (m *memoryStore) GetDeliveryByID(id int64) (*models.WebhookDelivery, error) {
+	for _, d := range m.deliveries {
+		if d.ID == id {
+			return &d, nil
+		}
+	}
+	return nil, ErrDeliveryNotFound
+}
+
+func (m *memoryStore) SaveDelivery(delivery *models.WebhookDelivery) error {
+	for i := range m.deliveries {
+		if m.deliveries[i].ID == delivery.ID {
+			m.deliveries[i] = *delivery
+		}
+	}
+	return nil
+}
+
+type queuedJob struct {
+	kind    string
+	payload []byte
+	runAt   time.Time
+}
+
+// memoryQueue holds the jobs the dispatcher queues; tests run them with
+// runDue. While err is set, queueing fails with it.
+type memoryQueue struct {
+	now  *time.Time
+	jobs []queuedJob
+	err  error
+}
+
+func (q *memoryQueue) Enqueue(kind string, payload any) error {
+	return q.EnqueueAt(kind, payload, *q.now)
+}
+
+func (q *memoryQueue) EnqueueAt(kind string, payload any, runAt time.Time) error {
+	if q.err != nil {
+		return q.err
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	q.jobs = append(q.jobs, queuedJob{kind: kind, payload: data, runAt: runAt})
+	return nil
+}
+
+// runDue runs the jobs that are due, including any they queue that are due
+// too, and reports how many ran.
+func (q *memoryQueue) runDue(t *testing.T, d *Dispatcher) int {
+	t.Helper()
+
+	ran := 0
+	for {
+		i := -1
+		for j, job := range q.jobs {
+			if !job.runAt.After(*q.now) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return ran
+		}
+
+		job := q.jobs[i]
+		q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+		handler := map[string]func(context.Context, []byte) error{
+			FanOutJob:  d.FanOut,
+			DeliverJob: d.Deliver,
+		}[job.kind]
+		if err := handler(context.Background(), job.payload); err != nil {
+			t.Fatalf("%s job: %v", job.kind, err)
+		}
+		ran++
+	}
+}
+
+// testDispatcher returns a dispatcher whose clock is under the test's control.
+func testDispatcher(store Store) (*Dispatcher, *memoryQueue, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	queue := &memoryQueue{now: &now}
+	d := NewDispatcher(store, queue, &http.Client{Timeout: time.Second})
+	d.now = func() time.Time { return now }
+	return d, queue, &now
+}
+
+func TestPublishDeliversSignedEvents(t *testing.T) {
+	const payload = `{"type":"post.created","data":{"id":1}}`
+
+	var got *http.Request
+	var body string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		got, body = r, string(b)
+	}))
+	defer receiver.Close()
+
+	store := &memoryStore{
+		webhooks: []models.Webhook{
+			{ID: 1, URL: receiver.URL, Secret: "s3cret", Events: []string{models.WebhookPostCreated}, Active: true},
+			{ID: 2, URL: receiver.URL, Events: []string{models.WebhookUserCreated}, Active: true},
+			{ID: 3, URL: receiver.URL, Events: []string{models.WebhookPostCreated}, Active: false},
+		},
+	}
+	d, queue, now := testDispatcher(store)
+
+	if err := d.Publish(models.WebhookPostCreated, payload); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	queue.runDue(t, d)
+
+	if len(store.deliveries) != 1 || store.deliveries[0].WebhookID != 1 {
+		t.Fatalf("deliveries = %+v, want one to the active subscriber", store.deliveries)
+	}
+	if s := store.deliveries[0].Status; s != models.DeliverySucceeded {
+		t.Errorf("status = %q, want %q", s, models.DeliverySucceeded)
+	}
+	if got == nil {
+		t.Fatal("receiver was not called")
+	}
+	if body != payload {
+		t.Errorf("body = %q, want %q", body, payload)
+	}
+	if e := got.Header.Get(HeaderEvent); e != models.WebhookPostCreated {
+		t.Errorf("%s = %q", HeaderEvent, e)
+	}
+	if id := got.Header.Get(HeaderEventID); id != "1" {
+		t.Errorf("%s = %q, want 1", HeaderEventID, id)
+	}
+	if sig, want := got.Header.Get(HeaderSignature), Sign("s3cret", *now, []byte(payload)); sig != want {
+		t.Errorf("%s = %q, want %q", HeaderSignature, sig, want)
+	}
+	if len(queue.jobs) != 0 {
+		t.Errorf("jobs left after success: %+v", queue.jobs)
+	}
+}
+
+func TestFanOutResumesAfterFailure(t *testing.T) {
+	store := &memoryStore{
+		webhooks: []models.Webhook{
+			{ID: 1, URL: "http://127.0.0.1:1", Events: []string{models.WebhookUserCreated}, Active: true},
+			{ID: 2, URL: "http://127.0.0.1:1", Events: []string{models.WebhookUserCreated}, Active: true},
+		},
+		events: []models.OutboxEvent{{ID: 7, Type: models.WebhookUserCreated, Payload: "{}"}},
+	}
+	d, queue, _ := testDispatcher(store)
+	job := []byte(`{"event_id":7}`)
+
+	queue.err = errors.New("queue unavailable")
+	if err := d.FanOut(context.Background(), job); err == nil {
+		t.Fatal("FanOut succeeded without queueing its deliveries")
+	}
+	if !store.events[0].DispatchedAt.IsZero() {
+		t.Fatal("event marked dispatched before its deliveries were queued")
+	}
+
+	// The job is run again: the delivery made by the first run is reused,
+	// and once everything is queued further runs do nothing.
+	queue.err = nil
+	for range 2 {
+		if err := d.FanOut(context.Background(), job); err != nil {
+			t.Fatalf("FanOut: %v", err)
+		}
+	}
+	if len(store.deliveries) != 2 || len(queue.jobs) != 2 {
+		t.Errorf("deliveries = %+v, jobs = %+v; want two of each", store.deliveries, queue.jobs)
+	}
+	if store.events[0].DispatchedAt.IsZero() {
+		t.Error("event not marked dispatched")
+	}
+}
+
+func TestFailedDeliveriesBackOffThenDie(t *testing.T) {
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	store := &memoryStore{
+		webhooks: []models.Webhook{{ID: 1, URL: receiver.URL, Events: []string{models.WebhookUserDeleted}, Active: true}},
+	}
+	d, queue, now := testDispatcher(store)
+	d.Publish(models.WebhookUserDeleted, "{}")
+
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		queue.runDue(t, d)
+		delivery := store.deliveries[0]
+		if delivery.Attempts != attempt || calls != attempt {
+			t.Fatalf("after run %d: attempts = %d, calls = %d", attempt, delivery.Attempts, calls)
+		}
+		if delivery.ResponseCode != http.StatusServiceUnavailable || !strings.Contains(delivery.LastError, "503") {
+			t.Errorf("attempt %d recorded code %d, error %q", attempt, delivery.ResponseCode, delivery.LastError)
+		}
+
+		if attempt == MaxAttempts {
+			if delivery.Status != models.DeliveryDead {
+				t.Errorf("status = %q after %d attempts, want dead", delivery.Status, attempt)
+			}
+			break
+		}
+		if wait := delivery.NextAttemptAt.Sub(*now); wait != Backoff(attempt) {
+			t.Errorf("attempt %d retries in %v, want %v", attempt, wait, Backoff(attempt))
+		}
+		if len(queue.jobs) != 1 || !queue.jobs[0].runAt.Equal(delivery.NextAttemptAt) {
+			t.Fatalf("after attempt %d: jobs = %+v, want one at %v", attempt, queue.jobs, delivery.NextAttemptAt)
+		}
+
+		// Not due yet: nothing is sent.
+		if queue.runDue(t, d) != 0 || calls != attempt {
+			t.Fatalf("retried before the backoff elapsed")
+		}
+		*now = delivery.NextAttemptAt
+	}
+
+	if len(queue.jobs) != 0 {
+		t.Errorf("dead delivery was queued again: %+v", queue.jobs)
+	}
+}
+
+func TestDisabledWebhookDeliveriesDie(t *testing.T) {
+	store := &memoryStore{
+		webhooks:   []models.Webhook{{ID: 1, URL: "http://127.0.0.1:1", Active: false}},
+		events:     []models.OutboxEvent{{ID: 1, DispatchedAt: time.Unix(1, 0)}},
+		deliveries: []models.WebhookDelivery{{ID: 1, WebhookID: 1, EventID: 1, Status: models.DeliveryPending}},
+	}
+	d, queue, _ := testDispatcher(store)
+
+	if err := d.Deliver(context.Background(), []byte(`{"delivery_id":1}`)); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if d := store.deliveries[0]; d.Status != models.DeliveryDead || d.Attempts != 0 {
+		t.Errorf("delivery = %+v, want dead without an attempt", d)
+	}
+	if len(queue.jobs) != 0 {
+		t.Errorf("dead delivery was queued again: %+v", queue.jobs)
+	}
+}
+
+func TestDeliverSkipsStaleJobs(t *testing.T) {
+	calls := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer receiver.Close()
+
+	now := time.Unix(1_700_000_000, 0)
+	store := &memoryStore{
+		webhooks: []models.Webhook{{ID: 1, URL: receiver.URL, Active: true}},
+		events:   []models.OutboxEvent{{ID: 1}},
+		deliveries: []models.WebhookDelivery{
+			{ID: 1, WebhookID: 1, EventID: 1, Status: models.DeliverySucceeded},
+			{ID: 2, WebhookID: 1, EventID: 1, Status: models.DeliveryPending, NextAttemptAt: now.Add(time.Minute)},
+		},
+	}
+	d, _, _ := testDispatcher(store)
+
+	for _, payload := range []string{`{"delivery_id":1}`, `{"delivery_id":2}`, `{"delivery_id":3}`} {
+		if err := d.Deliver(context.Background(), []byte(payload)); err != nil {
+			t.Fatalf("Deliver(%s): %v", payload, err)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("sent %d requests for sent, not yet due and missing deliveries", calls)
+	}
+}
+
+func TestRetryQueuesDeadDelivery(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	store := &memoryStore{
+		webhooks:   []models.Webhook{{ID: 1, URL: receiver.URL, Active: true}},
+		events:     []models.OutboxEvent{{ID: 1}},
+		deliveries: []models.WebhookDelivery{{ID: 1, WebhookID: 1, EventID: 1, Status: models.DeliveryDead, Attempts: MaxAttempts}},
+	}
+	d, queue, _ := testDispatcher(store)
+
+	delivery := store.deliveries[0]
+	if err := d.Retry(&delivery); err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	queue.runDue(t, d)
+
+	if d := store.deliveries[0]; d.Status != models.DeliverySucceeded || d.Attempts != 1 {
+		t.Errorf("delivery = %+v, want sent on a fresh first attempt", d)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{8, 64 * time.Minute},
+		{20, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	at := time.Unix(1_700_000_000, 0)
+	sig := Sign("secret", at, []byte(`{"a":1}`))
+
+	if !strings.HasPrefix(sig, "t="+strconv.FormatInt(at.Unix(), 10)+",v1=") {
+		t.Fatalf("Sign = %q, want the timestamp first", sig)
+	}
+	if sig == Sign("other", at, []byte(`{"a":1}`)) {
+		t.Error("signature does not depend on the secret")
+	}
+	if sig == Sign("secret", at.Add(time.Second), []byte(`{"a":1}`)) {
+		t.Error("signature does not depend on the timestamp")
+	}
+	if sig == Sign("secret", at, []byte(`{"a":2}`)) {
+		t.Error("signature does not depend on the body")
+	}
+}
@@ -1,7 +1,7 @@
 import { goto } from '$app/navigation';
 import { browser } from '$app/environment';
 
-const API_URL = import.meta.env.VITE_API_URL;
+export const API_URL = import.meta.env.VITE_API_URL;
 
 interface FetchOptions extends RequestInit {
 	skipAuthRedirect?: boolean;
@@ -12,11 +12,11 @@ export async function apiRequest(endpoint: string, options: FetchOptions = {}) {
 
 	const response = await fetch(`${API_URL}${endpoint}`, {
 		credentials: 'include',
+		...fetchOptions,
 		headers: {
 			'Content-Type': 'application/json',
 			...fetchOptions.headers
-		},
-		...fetchOptions
+		}
 	});
 
 	if (response.status === 401 && !skipAuthRedirect && browser) {
@@ -0,0 +1,56 @@
+import { apiRequest } from './api';
+
+export interface Notification {
+	id: number;
+	kind: 'comment' | 'reply' | 'reaction' | 'follow';
+	actor_id: number;
+	actor_name?: string;
+	actor_image?: string;
+	post_id?: number;
+	post_title?: string;
+	post_slug?: string;
+	comment_id?: number;
+	reaction?: string;
+	read: boolean;
+	read_at?: string;
+	created_at: string;
+}
+
+export interface NotificationPreferences {
+	comments: boolean;
+	replies: boolean;
+	reactions: boolean;
+	follows: boolean;
+}
+
+export async function getNotifications(
+	unreadOnly = false
+): Promise<{ notifications: Notification[]; unread_count: number }> {
+	const data = await apiRequest(`/api/notifications${unreadOnly ? '?unread=true' : ''}`);
+	return { notifications: data.notifications || [], unread_count: data.unread_count };
+}
+
+export async function markNotificationRead(id: number): Promise<number> {
+	const data = await apiRequest(`/api/notifications/${id}/read`, { method: 'POST' });
+	return data.unread_count;
+}
+
+export async function markAllNotificationsRead(): Promise<number> {
+	const data = await apiRequest('/api/notifications/read-all', { method: 'POST' });
+	return data.unread_count;
+}
+
+export async function getNotificationPreferences(): Promise<NotificationPreferences> {
+	const data = await apiRequest('/api/notifications/preferences');
+	return data.preferences;
+}
+
+export async function updateNotificationPreferences(
+	prefs: Partial<NotificationPreferences>
+): Promise<NotificationPreferences> {
+	const data = await apiRequest('/api/notifications/preferences', {
+		method: 'PUT',
+		body: JSON.stringify(prefs)
+	});
+	return data.preferences;
+}
@@ -1,15 +1,27 @@
-import { apiRequest } from './api';
+import { API_URL, apiRequest } from './api';
 
 export interface Post {
 	id: number;
 	user_id: number;
 	title: string;
+	slug: string;
 	content: string;
+	format: 'plain' | 'markdown';
+	content_html: string;
 	created_at: string;
 	updated_at: string;
 	author_name?: string;
-	author_email?: string;
 	author_image?: string;
+	is_owner?: boolean;
+	status?: 'draft' | 'scheduled' | 'published' | 'archived';
+	publish_at?: string;
+	version: number;
+	tags: string[];
+	comment_count: number;
+	reactions: Record<string, number>;
+	liked_by_me: boolean;
+	my_reactions: string[];
+	bookmarked: boolean;
 }
 
 export async function getAllPosts(): Promise<Post[]> {
@@ -17,6 +29,55 @@ export async function getAllPosts(): Promise<Post[]> {
 	return data.posts || [];
 }
 
+export async function getFeed(): Promise<Post[]> {
+	const data = await apiRequest('/api/feed');
+	return data.posts || [];
+}
+
+export async function getBookmarks(): Promise<Post[]> {
+	const data = await apiRequest('/api/users/me/bookmarks');
+	return data.posts || [];
+}
+
+export async function setBookmark(id: number, saved: boolean): Promise<Post> {
+	const data = await apiRequest(`/api/posts/${id}/bookmark`, {
+		method: saved ? 'PUT' : 'DELETE'
+	});
+	return data.post;
+}
+
+export type PostEvent =
+	| { type: 'post.created' | 'post.updated'; post: Post }
+	| { type: 'post.deleted'; id: number };
+
+// subscribePosts calls onEvent for every post change the server pushes.
+// EventSource reconnects on its own; refetch on 'open' after an error so
+// changes missed while disconnected are picked up. Returns an unsubscribe
+// function.
+export function subscribePosts(onEvent: (event: PostEvent) => void, onReconnect?: () => void) {
+	const source = new EventSource(`${API_URL}/api/posts/stream`, { withCredentials: true });
+	let dropped = false;
+
+	for (const type of ['post.created', 'post.updated'] as const) {
+		source.addEventListener(type, (e) => onEvent({ type, post: JSON.parse(e.data) }));
+	}
+	source.addEventListener('post.deleted', (e) =>
+		onEvent({ type: 'post.deleted', id: JSON.parse(e.data).id })
+	);
+	source.addEventListener('error', () => (dropped = true));
+	source.addEventListener('open', () => {
+		if (dropped) onReconnect?.();
+		dropped = false;
+	});
+
+	return () => source.close();
+}
+
+export async function getPostBySlug(slug: string): Promise<Post> {
+	const data = await apiRequest(`/api/posts/by-slug/${encodeURIComponent(slug)}`);
+	return data.post;
+}
+
 export async function getPost(id: number): Promise<Post> {
 	const data = await apiRequest(`/api/posts/${id}`);
 	return data.post;
@@ -35,16 +96,29 @@ export async function createPost(title: string, content: string): Promise<Post>
 	return data.post;
 }
 
-export async function updatePost(id: number, title: string, content: string): Promise<Post> {
+// The API rejects writes whose If-Match does not name the version the
+// editor started from, so concurrent edits fail instead of overwriting.
+function ifMatch(version: number): Record<string, string> {
+	return { 'If-Match': `"${version}"` };
+}
+
+export async function updatePost(
+	id: number,
+	title: string,
+	content: string,
+	version: number
+): Promise<Post> {
 	const data = await apiRequest(`/api/posts/${id}`, {
 		method: 'PUT',
+		headers: ifMatch(version),
 		body: JSON.stringify({ title, content })
 	});
 	return data.post;
 }
 
-export async function deletePost(id: number): Promise<void> {
+export async function deletePost(id: number, version: number): Promise<void> {
 	await apiRequest(`/api/posts/${id}`, {
-		method: 'DELETE'
+		method: 'DELETE',
+		headers: ifMatch(version)
 	});
 }